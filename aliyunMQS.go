@@ -8,7 +8,6 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/xml"
-	"errors"
 	"fmt"
 	"io/ioutil"
 	//"log"
@@ -36,6 +35,10 @@ type Queue struct {
 // 消息
 type Message struct {
 	MQS
+	// 设置后对消息正文进行信封加密，接收时自动解密
+	Encryptor *Encryptor
+	// 设置后对消息签名，接收时校验签名
+	Signer *Signer
 }
 
 // @Title 创建一个Mqs
@@ -91,11 +94,11 @@ func (this *MQS) httpClient(verb, request_uri string, headers map[string]string,
 		request.Header.Set(k, v)
 	}
 	response, err := client.Do(request)
-	defer response.Body.Close()
 	client = nil
 	if err != nil {
 		return "client请求失败", err
 	}
+	defer response.Body.Close()
 	content, err := ioutil.ReadAll(response.Body)
 	if err != nil {
 		return "获取response.Body失败", err
@@ -104,7 +107,7 @@ func (this *MQS) httpClient(verb, request_uri string, headers map[string]string,
 	if response.StatusCode/100 > 1 && response.StatusCode/100 < 4 {
 		return string(content), nil
 	} else {
-		return string(content), errors.New(fmt.Sprintf("Code:%d,Content:%s", response.StatusCode, string(content)))
+		return string(content), newMQSError(response.StatusCode, string(content))
 	}
 }
 
@@ -136,8 +139,11 @@ func (this *MQS) getSignature(verb, content_md5, content_type, gmt_date, Canonic
 
 // @Title 创建一个新的消息队列
 // @Param queuename 队列名称
-// @Param param 参数
+// @Param param 参数，名称或取值范围错误时不发送请求
 func (this *Queue) CreateQueue(queuename string, param map[string]int) (string, error) {
+	if err := validateParam(param, queueParams); err != nil {
+		return "参数错误", err
+	}
 	//默认参数
 	_param := map[string]int{"DelaySeconds": 0, "MaximumMessageSize": 65536, "MessageRetentionPeriod": 345600, "VisibilityTimeout": 30, "PollingWaitSeconds": 0}
 	for k, _ := range _param {
@@ -197,35 +203,33 @@ func (this *Queue) CreateQueue(queuename string, param map[string]int) (string,
 	return this.httpClient(verb, request_uri, headers, body.String())
 }
 
-// @Title 修改消息队列属性
+// @Title 修改消息队列属性，只修改param中给出的属性，其余属性保持不变
 // @Param queuename 队列名称
-// @Param param 参数
+// @Param param 参数，名称或取值范围错误时不发送请求
 func (this *Queue) SetQueueAttributes(queuename string, param map[string]int) (string, error) {
-	//默认参数
-	_param := map[string]int{"DelaySeconds": 0, "MaximumMessageSize": 65536, "MessageRetentionPeriod": 345600, "VisibilityTimeout": 30, "PollingWaitSeconds": 0}
-	for k, _ := range _param {
-		for x, y := range param {
-			if x == k {
-				_param[k] = y
-			}
-		}
+	if err := validateParam(param, queueParams); err != nil {
+		return "参数错误", err
 	}
+	return this.UpdateQueueAttributes(queuename, newAttributesUpdate(param))
+}
 
+// @Title 修改消息队列属性，只修改update中不为nil的属性
+// @Param queuename 队列名称
+// @Param update 要修改的属性，取值范围错误时不发送请求
+func (this *Queue) UpdateQueueAttributes(queuename string, update *QueueAttributesUpdate) (string, error) {
+	if update == nil {
+		update = &QueueAttributesUpdate{}
+	}
+	if err := validateParam(update.params(), queueParams); err != nil {
+		return "参数错误", err
+	}
 	_xml_param := struct {
-		XMLName                xml.Name `xml:"Queue"`
-		Xmlns                  string   `xml:"xmlns,attr"`
-		DelaySeconds           int      `xml:"DelaySeconds,omitempty"`
-		MaximumMessageSize     int      `xml:"MaximumMessageSize,omitempty"`
-		MessageRetentionPeriod int      `xml:"MessageRetentionPeriod,omitempty"`
-		VisibilityTimeout      int      `xml:"VisibilityTimeout,omitempty"`
-		PollingWaitSeconds     int      `xml:"PollingWaitSeconds,omitempty"`
+		XMLName xml.Name `xml:"Queue"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		*QueueAttributesUpdate
 	}{
-		Xmlns:                  "http://mqs.aliyuncs.com/doc/v1/",
-		DelaySeconds:           _param["DelaySeconds"],
-		MaximumMessageSize:     _param["MaximumMessageSize"],
-		MessageRetentionPeriod: _param["MessageRetentionPeriod"],
-		VisibilityTimeout:      _param["VisibilityTimeout"],
-		PollingWaitSeconds:     _param["PollingWaitSeconds"]}
+		Xmlns:                 "http://mqs.aliyuncs.com/doc/v1/",
+		QueueAttributesUpdate: update}
 	content_body, err := this.toXml(_xml_param)
 	if err != nil {
 		return "生成xml失败", err
@@ -291,6 +295,16 @@ func (this *Queue) GetQueueAttributes(queuename string) (string, error) {
 	return this.httpClient(verb, request_uri, headers, content_body)
 }
 
+// @Title 同 GetQueueAttributes，返回解析后的队列属性
+// @Param queuename 队列名称
+func (this *Queue) Attributes(queuename string) (*QueueAttributes, error) {
+	content, err := this.GetQueueAttributes(queuename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseQueueAttributes(content)
+}
+
 // @Title 用于删除一个已创建的消息队列
 // @Param queuename 队列名称
 func (this *Queue) DeleteQueue(queuename string) (string, error) {
@@ -338,7 +352,7 @@ func (this *Queue) ListQueue(prefix, marker, number string) (string, error) {
 		CanonicalizedMQSHeaders["x-mqs-prefix"] = prefix
 	}
 	if strings.TrimSpace(marker) != "" {
-		CanonicalizedMQSHeaders["x-mqs-marker'"] = marker
+		CanonicalizedMQSHeaders["x-mqs-marker"] = marker
 	}
 	if strings.TrimSpace(number) != "" {
 		CanonicalizedMQSHeaders["x-mqs-ret-number"] = number
@@ -369,7 +383,33 @@ func (this *Queue) ListQueue(prefix, marker, number string) (string, error) {
 // @Param param 		参数
 //        -- delayseconds 	指定 的秒数延后可被消费,单 位为秒，0-345600 秒(4 天)范围内 某个整数值
 // 		  -- priority 		指定消息的优先级 权值。优先级越高的消 息,越容易更早被消费，取值范围 1~16(其中 1 为 最高优先级),默认优先级 为8
+//        参数名称或取值范围错误时不发送请求
 func (this *Message) SendMessage(queuename, messagebody string, param map[string]int) (string, error) {
+	if this.useEnvelope() {
+		return this.SendEnvelope(queuename, NewEnvelope(messagebody), param)
+	}
+	return this.sendMessage(queuename, messagebody, param)
+}
+
+// @Title 以信封形式发送消息，配置了 Encryptor/Signer 时加密、签名信封
+// @Param queuename 	队列名称
+// @Param env 			信封
+// @Param param 		参数，同 SendMessage
+func (this *Message) SendEnvelope(queuename string, env *Envelope, param map[string]int) (string, error) {
+	if err := this.sealEnvelope(env); err != nil {
+		return "封装消息失败", err
+	}
+	messagebody, err := env.Encode()
+	if err != nil {
+		return "生成信封失败", err
+	}
+	return this.sendMessage(queuename, messagebody, param)
+}
+
+func (this *Message) sendMessage(queuename, messagebody string, param map[string]int) (string, error) {
+	if err := validateParam(param, messageParams); err != nil {
+		return "参数错误", err
+	}
 	//默认参数
 	_param := map[string]int{"DelaySeconds": 0, "Priority": 8}
 	for k, _ := range _param {
@@ -427,6 +467,35 @@ func (this *Message) SendMessage(queuename, messagebody string, param map[string
 // @Param queuename		队列名称
 // @Param waitseconds 	本次 ReceiveMessage 请求最长的 Polling 等待时间1,单位为秒
 func (this *Message) ReceiveMessage(queuename string, waitseconds int) (string, error) {
+	if this.Signer != nil {
+		if err := this.Signer.Validate(); err != nil {
+			return "签名配置错误", err
+		}
+	}
+	content, err := this.receiveMessage(queuename, waitseconds)
+	if err != nil || !this.useEnvelope() {
+		return content, err
+	}
+	return this.openContent(queuename, content)
+}
+
+// @Title 同 ReceiveMessage，返回解析后的消息。消息无法解密时同时返回未解密的消息和 *OpenError
+// @Param queuename		队列名称
+// @Param waitseconds 	本次 ReceiveMessage 请求最长的 Polling 等待时间,单位为秒
+func (this *Message) Receive(queuename string, waitseconds int) (*ReceivedMessage, error) {
+	if this.Signer != nil {
+		if err := this.Signer.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	content, err := this.receiveMessage(queuename, waitseconds)
+	if err != nil {
+		return nil, err
+	}
+	return this.parseMessage(queuename, content)
+}
+
+func (this *Message) receiveMessage(queuename string, waitseconds int) (string, error) {
 	verb := "GET"
 	content_body := ""
 	content_md5 := ""
@@ -490,6 +559,24 @@ func (this *Message) DeleteMessage(queuename, receipthandle string) (string, err
 //        在 VisibilityTimeout 的时间内不可被查看或消费
 // @Param queuename		队列名称
 func (this *Message) PeekMessage(queuename string) (string, error) {
+	content, err := this.peekMessage(queuename)
+	if err != nil || !this.useEnvelope() {
+		return content, err
+	}
+	return this.openContent(queuename, content)
+}
+
+// @Title 同 PeekMessage，返回解析后的消息
+// @Param queuename		队列名称
+func (this *Message) Peek(queuename string) (*ReceivedMessage, error) {
+	content, err := this.peekMessage(queuename)
+	if err != nil {
+		return nil, err
+	}
+	return this.parseMessage(queuename, content)
+}
+
+func (this *Message) peekMessage(queuename string) (string, error) {
 	verb := "GET"
 	content_body := ""
 	content_md5 := ""
@@ -548,3 +635,89 @@ func (this *Message) ChangeMessageVisibility(queuename, receipthandle string, vi
 
 	return this.httpClient(verb, request_uri, headers, string(content_body))
 }
+
+// 是否需要用信封包装消息正文
+func (this *Message) useEnvelope() bool {
+	return this.Encryptor != nil || this.Signer != nil
+}
+
+func (this *Message) sealEnvelope(env *Envelope) error {
+	if this.Encryptor != nil {
+		if err := this.Encryptor.Seal(env); err != nil {
+			return err
+		}
+	}
+	if this.Signer != nil {
+		if err := this.Signer.Sign(env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 按配置把消息正文封装为信封，不需要信封时原样返回
+func (this *Message) encodeMessage(messagebody string) (string, error) {
+	if !this.useEnvelope() {
+		return messagebody, nil
+	}
+	env := NewEnvelope(messagebody)
+	if err := this.sealEnvelope(env); err != nil {
+		return "", err
+	}
+	return env.Encode()
+}
+
+// 解开消息正文中的信封，正文不是信封时原样返回
+func (this *Message) openMessage(queuename string, msg *ReceivedMessage) error {
+	env, ok := DecodeEnvelope(msg.MessageBody)
+	if this.Signer != nil {
+		if err := this.Signer.Verify(env); err != nil {
+			if err := this.rejectUnsigned(queuename, msg, err); err != nil {
+				return err
+			}
+		}
+	}
+	if !ok {
+		if this.Encryptor != nil && !this.Encryptor.AllowPlaintext {
+			return &OpenError{Message: msg, Err: ErrNotEncrypted}
+		}
+		return nil
+	}
+	if this.Encryptor != nil {
+		if err := this.Encryptor.Open(env); err != nil {
+			return &OpenError{Message: msg, Err: err}
+		}
+	}
+	msg.Envelope = env
+	msg.MessageBody = env.Body
+	return nil
+}
+
+func (this *Message) parseMessage(queuename, content string) (*ReceivedMessage, error) {
+	msg, err := ParseReceivedMessage(content)
+	if err != nil {
+		return nil, err
+	}
+	msg.client = this
+	msg.queuename = queuename
+	if err := this.openMessage(queuename, msg); err != nil {
+		if _, ok := err.(*OpenError); ok {
+			return msg, err
+		}
+		return nil, err
+	}
+	return msg, nil
+}
+
+// 解开返回xml中的信封，重新生成xml
+func (this *Message) openContent(queuename, content string) (string, error) {
+	msg, err := this.parseMessage(queuename, content)
+	if err != nil {
+		return "解析消息失败", err
+	}
+	output, err := msg.toXml()
+	if err != nil {
+		return "生成xml失败", err
+	}
+	return output, nil
+}
@@ -0,0 +1,39 @@
+package aliyunMQS
+
+import (
+	"math"
+	"time"
+)
+
+// 指数退避，第n次投递失败后等待 Initial*Multiplier^(n-1)，不超过 Max。
+// Max 为0时不超过 VisibilityTimeout 的上限12小时
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+// 默认退避：1秒起，每次翻倍，最长1小时
+var DefaultBackoff = &Backoff{Initial: time.Second, Max: time.Hour, Multiplier: 2}
+
+// @Title 计算第 dequeuecount 次投递失败后的等待时间
+// @Param dequeuecount 消息的 DequeueCount
+func (this *Backoff) Delay(dequeuecount int) time.Duration {
+	if dequeuecount < 1 {
+		dequeuecount = 1
+	}
+	multiplier := this.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	max := this.Max
+	if max <= 0 {
+		max = maxVisibilityTimeout * time.Second
+	}
+	// 在浮点数上比较，避免转换成 Duration 时溢出
+	delay := float64(this.Initial) * math.Pow(multiplier, float64(dequeuecount-1))
+	if math.IsNaN(delay) || delay > float64(max) {
+		return max
+	}
+	return time.Duration(delay)
+}
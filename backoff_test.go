@@ -0,0 +1,69 @@
+package aliyunMQS
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBackoff(t *testing.T) {
+	Convey("退避重试测试", t, func() {
+		Convey("按投递次数指数增长", func() {
+			backoff := &Backoff{Initial: time.Second, Max: 10 * time.Second, Multiplier: 2}
+			So(backoff.Delay(0), ShouldEqual, time.Second)
+			So(backoff.Delay(1), ShouldEqual, time.Second)
+			So(backoff.Delay(3), ShouldEqual, 4*time.Second)
+			So(backoff.Delay(10), ShouldEqual, 10*time.Second)
+		})
+
+		Convey("投递次数很大时不溢出", func() {
+			backoff := &Backoff{Initial: time.Second, Multiplier: 2}
+			So(backoff.Delay(35), ShouldEqual, 12*time.Hour)
+			So(backoff.Delay(5000), ShouldEqual, 12*time.Hour)
+			So(DefaultBackoff.Delay(1000000), ShouldEqual, time.Hour)
+			monotonic := true
+			for n := 1; n < 2000; n++ {
+				monotonic = monotonic && backoff.Delay(n+1) >= backoff.Delay(n)
+			}
+			So(monotonic, ShouldBeTrue)
+		})
+
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		queue.CreateQueue("jobs", nil)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+		msg.SendMessage("jobs", "j1", nil)
+
+		Convey("Nack后消息在delay后可见", func() {
+			m, err := msg.Receive("jobs", 0)
+			So(err, ShouldBeNil)
+			handle := m.ReceiptHandle
+			So(m.Nack(1500*time.Millisecond), ShouldBeNil)
+			So(m.ReceiptHandle, ShouldNotEqual, handle)
+			So(m.NextVisibleTime-time.Now().UnixNano()/1e6, ShouldBeBetween, 1000, 2100)
+		})
+
+		Convey("消费者处理失败后Nack", func() {
+			consumer := NewConsumer(&msg, "jobs", func(m *ReceivedMessage) error {
+				return errors.New("retry")
+			})
+			consumer.Backoff = &Backoff{Initial: time.Second, Multiplier: 2}
+			m, _ := msg.Receive("jobs", 0)
+			before := m.ReceiptHandle
+			So(consumer.Process(m), ShouldNotBeNil)
+			So(m.ReceiptHandle, ShouldNotEqual, before)
+			_, err := msg.Receive("jobs", 0)
+			So(IsMessageNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("非Receive获得的消息不能Nack", func() {
+			m, _ := msg.Peek("jobs")
+			So(m.Nack(time.Second), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,93 @@
+package aliyunMQS
+
+import (
+	"fmt"
+	"time"
+)
+
+// 队列配置备份文件的格式版本
+const BackupVersion = 1
+
+// 队列配置备份
+type QueueBackup struct {
+	Version   int            `json:"Version" yaml:"Version"`
+	CreatedAt time.Time      `json:"CreatedAt" yaml:"CreatedAt"`
+	Prefix    string         `json:"Prefix,omitempty" yaml:"Prefix,omitempty"`
+	Queues    []*QueueConfig `json:"Queues" yaml:"Queues"`
+}
+
+// 恢复时遇到已存在队列的处理方式
+type RestorePolicy int
+
+const (
+	// 跳过已存在的队列
+	RestoreSkip RestorePolicy = iota
+	// 用备份的属性覆盖已存在的队列
+	RestoreOverwrite
+)
+
+// 恢复结果
+type RestoreResult struct {
+	Created     []string
+	Overwritten []string
+	Skipped     []string
+}
+
+// @Title 备份所有队列及其属性
+// @Param prefix 只备份以此前缀开头的队列
+func (this *Queue) Backup(prefix string) (*QueueBackup, error) {
+	backup := &QueueBackup{Version: BackupVersion, CreatedAt: time.Now().UTC(), Prefix: prefix, Queues: []*QueueConfig{}}
+	for q, err := range this.ListQueues(ListOptions{Prefix: prefix}) {
+		if err != nil {
+			return nil, err
+		}
+		attrs, err := this.Attributes(q.Name)
+		if err != nil {
+			if IsQueueNotExist(err) {
+				// 列出后被删除
+				continue
+			}
+			return nil, err
+		}
+		backup.Queues = append(backup.Queues, &QueueConfig{
+			Name:                   q.Name,
+			DelaySeconds:           Int(attrs.DelaySeconds),
+			MaximumMessageSize:     Int(attrs.MaximumMessageSize),
+			MessageRetentionPeriod: Int(attrs.MessageRetentionPeriod),
+			VisibilityTimeout:      Int(attrs.VisibilityTimeout),
+			PollingWaitSeconds:     Int(attrs.PollingWaitSeconds),
+		})
+	}
+	return backup, nil
+}
+
+// @Title 按备份创建队列，可以恢复到其他账号或地域。出错时停止并返回已完成的部分
+// @Param backup 	由 Backup 生成的备份
+// @Param policy 	遇到已存在队列的处理方式
+func (this *Queue) Restore(backup *QueueBackup, policy RestorePolicy) (*RestoreResult, error) {
+	result := &RestoreResult{}
+	if backup.Version != BackupVersion {
+		return result, fmt.Errorf("不支持的备份版本%d", backup.Version)
+	}
+	for _, config := range backup.Queues {
+		param := config.param()
+		if err := validateParam(param, queueParams); err != nil {
+			return result, fmt.Errorf("队列%s: %w", config.Name, err)
+		}
+		_, err := this.CreateQueue(config.Name, param)
+		switch {
+		case err == nil:
+			result.Created = append(result.Created, config.Name)
+		case IsQueueAlreadyExist(err) && policy == RestoreOverwrite:
+			if _, err := this.SetQueueAttributes(config.Name, param); err != nil {
+				return result, fmt.Errorf("队列%s: %w", config.Name, err)
+			}
+			result.Overwritten = append(result.Overwritten, config.Name)
+		case IsQueueAlreadyExist(err):
+			result.Skipped = append(result.Skipped, config.Name)
+		default:
+			return result, fmt.Errorf("队列%s: %w", config.Name, err)
+		}
+	}
+	return result, nil
+}
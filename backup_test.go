@@ -0,0 +1,63 @@
+package aliyunMQS
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestBackup(t *testing.T) {
+	Convey("队列配置备份恢复测试", t, func() {
+		source := newMockMQS()
+		defer source.Close()
+		target := newMockMQS()
+		defer target.Close()
+		var from, to Queue
+		source.NewMQS(&from.MQS)
+		target.NewMQS(&to.MQS)
+		from.CreateQueue("app-a", map[string]int{"VisibilityTimeout": 60})
+		from.CreateQueue("app-b", map[string]int{"PollingWaitSeconds": 10})
+		from.CreateQueue("other", nil)
+
+		backup, err := from.Backup("app-")
+		So(err, ShouldBeNil)
+		So(backup.Version, ShouldEqual, BackupVersion)
+		So(len(backup.Queues), ShouldEqual, 2)
+		So(*backup.Queues[0].VisibilityTimeout, ShouldEqual, 60)
+
+		// 经过序列化后恢复
+		content, err := json.Marshal(backup)
+		So(err, ShouldBeNil)
+		restored := &QueueBackup{}
+		So(json.Unmarshal(content, restored), ShouldBeNil)
+
+		Convey("恢复到另一个账号", func() {
+			result, err := to.Restore(restored, RestoreSkip)
+			So(err, ShouldBeNil)
+			So(result.Created, ShouldResemble, []string{"app-a", "app-b"})
+			So(target.queues["app-a"].attrs["VisibilityTimeout"], ShouldEqual, 60)
+			So(target.queues["app-b"].attrs["PollingWaitSeconds"], ShouldEqual, 10)
+		})
+
+		Convey("已存在的队列按策略跳过或覆盖", func() {
+			to.CreateQueue("app-a", map[string]int{"VisibilityTimeout": 5})
+			result, err := to.Restore(restored, RestoreSkip)
+			So(err, ShouldBeNil)
+			So(result.Skipped, ShouldResemble, []string{"app-a"})
+			So(target.queues["app-a"].attrs["VisibilityTimeout"], ShouldEqual, 5)
+
+			result, err = to.Restore(restored, RestoreOverwrite)
+			So(err, ShouldBeNil)
+			So(result.Overwritten, ShouldResemble, []string{"app-a", "app-b"})
+			So(target.queues["app-a"].attrs["VisibilityTimeout"], ShouldEqual, 60)
+		})
+
+		Convey("不支持的版本", func() {
+			restored.Version = 99
+			_, err := to.Restore(restored, RestoreSkip)
+			So(err, ShouldNotBeNil)
+			So(target.queues, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,157 @@
+// mqs-exporter 定期调用 GetQueueAttributes，以 Prometheus 格式输出队列的消息数和属性
+//
+// 用法: mqs-exporter [-listen :9470] [-interval 30s] [-prefix app-,job-] [-queue orders]
+//
+// 未指定 -prefix 和 -queue 时监控所有队列。访问凭证可以通过参数或环境变量
+// MQS_ACCESS_KEY、MQS_ACCESS_SECRET、MQS_QUEUE_OWNER_ID、MQS_URL 指定。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/congjunwei/aliyunMQS"
+)
+
+// 输出的指标
+var gauges = []struct {
+	name  string
+	help  string
+	value func(attrs *aliyunMQS.QueueAttributes) int
+}{
+	{"mqs_queue_active_messages", "可以被接收的消息数", func(a *aliyunMQS.QueueAttributes) int { return a.ActiveMessages }},
+	{"mqs_queue_inactive_messages", "被接收后处于不可见状态的消息数", func(a *aliyunMQS.QueueAttributes) int { return a.InactiveMessages }},
+	{"mqs_queue_delay_messages", "延迟中的消息数", func(a *aliyunMQS.QueueAttributes) int { return a.DelayMessages }},
+	{"mqs_queue_delay_seconds", "队列的 DelaySeconds", func(a *aliyunMQS.QueueAttributes) int { return a.DelaySeconds }},
+	{"mqs_queue_maximum_message_size_bytes", "队列的 MaximumMessageSize", func(a *aliyunMQS.QueueAttributes) int { return a.MaximumMessageSize }},
+	{"mqs_queue_message_retention_period_seconds", "队列的 MessageRetentionPeriod", func(a *aliyunMQS.QueueAttributes) int { return a.MessageRetentionPeriod }},
+	{"mqs_queue_visibility_timeout_seconds", "队列的 VisibilityTimeout", func(a *aliyunMQS.QueueAttributes) int { return a.VisibilityTimeout }},
+	{"mqs_queue_polling_wait_seconds", "队列的 PollingWaitSeconds", func(a *aliyunMQS.QueueAttributes) int { return a.PollingWaitSeconds }},
+}
+
+// Prometheus 文本格式的标签值只转义反斜杠、双引号和换行
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// 定期采集队列属性，/metrics 输出最近一次的结果
+type exporter struct {
+	queue    *aliyunMQS.Queue
+	prefixes []string
+	queues   []string
+
+	lock     sync.RWMutex
+	attrs    []*aliyunMQS.QueueAttributes
+	success  bool
+	scraped  time.Time
+	duration time.Duration
+}
+
+func main() {
+	accessKey := flag.String("access-key", os.Getenv("MQS_ACCESS_KEY"), "AccessKey")
+	accessSecret := flag.String("access-secret", os.Getenv("MQS_ACCESS_SECRET"), "AccessSecret")
+	queueOwnId := flag.String("owner-id", os.Getenv("MQS_QUEUE_OWNER_ID"), "QueueOwnerId")
+	mqsUrl := flag.String("endpoint", os.Getenv("MQS_URL"), "MQS服务地址，如 mqs-cn-beijing.aliyuncs.com")
+	listen := flag.String("listen", ":9470", "监听地址")
+	interval := flag.Duration("interval", 30*time.Second, "采集间隔")
+	prefixes := flag.String("prefix", "", "按前缀发现队列，多个前缀用逗号分隔")
+	queues := flag.String("queue", "", "指定监控的队列，多个队列用逗号分隔")
+	flag.Parse()
+
+	e := &exporter{queue: &aliyunMQS.Queue{}, prefixes: split(*prefixes), queues: split(*queues)}
+	e.queue.NewMQS(*accessKey, *accessSecret, *queueOwnId, *mqsUrl)
+	if len(e.prefixes) == 0 && len(e.queues) == 0 {
+		e.prefixes = []string{""}
+	}
+	go func() {
+		for {
+			e.scrape()
+			time.Sleep(*interval)
+		}
+	}()
+
+	http.HandleFunc("/metrics", e.serveMetrics)
+	log.Printf("mqs-exporter 监听 %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, nil))
+}
+
+func split(s string) []string {
+	list := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// 发现队列并获取属性。单个队列失败时跳过，整体记为失败
+func (this *exporter) scrape() {
+	start := time.Now()
+	success := true
+	names := map[string]bool{}
+	for _, name := range this.queues {
+		names[name] = true
+	}
+	for _, prefix := range this.prefixes {
+		err := this.queue.ListQueuesEach(aliyunMQS.ListOptions{Prefix: prefix}, func(q *aliyunMQS.QueueInfo) error {
+			names[q.Name] = true
+			return nil
+		})
+		if err != nil {
+			log.Printf("列出前缀为%q的队列失败: %v", prefix, err)
+			success = false
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	attrs := []*aliyunMQS.QueueAttributes{}
+	for _, name := range sorted {
+		a, err := this.queue.Attributes(name)
+		if err != nil {
+			log.Printf("获取队列%s的属性失败: %v", name, err)
+			success = false
+			continue
+		}
+		// 以请求的名称为准
+		a.QueueName = name
+		attrs = append(attrs, a)
+	}
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.attrs = attrs
+	this.success = success
+	this.scraped = time.Now()
+	this.duration = time.Since(start)
+}
+
+func (this *exporter) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, g := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+		for _, a := range this.attrs {
+			fmt.Fprintf(w, "%s{queue=\"%s\"} %d\n", g.name, labelEscaper.Replace(a.QueueName), g.value(a))
+		}
+	}
+	success := 0
+	if this.success {
+		success = 1
+	}
+	fmt.Fprintf(w, "# HELP mqs_scrape_success 最近一次采集是否全部成功\n# TYPE mqs_scrape_success gauge\nmqs_scrape_success %d\n", success)
+	if !this.scraped.IsZero() {
+		fmt.Fprintf(w, "# HELP mqs_scrape_timestamp_seconds 最近一次采集的时间\n# TYPE mqs_scrape_timestamp_seconds gauge\nmqs_scrape_timestamp_seconds %d\n", this.scraped.Unix())
+		fmt.Fprintf(w, "# HELP mqs_scrape_duration_seconds 最近一次采集的耗时\n# TYPE mqs_scrape_duration_seconds gauge\nmqs_scrape_duration_seconds %g\n", this.duration.Seconds())
+	}
+}
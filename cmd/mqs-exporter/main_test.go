@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/congjunwei/aliyunMQS"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// 只支持列出队列和获取队列属性的MQS桩服务，队列名对应可见消息数
+func newFakeMQS(queues map[string]int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Trim(r.URL.Path, "/")
+		if name == "" {
+			prefix := r.Header.Get("x-mqs-prefix")
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Queues xmlns="http://mqs.aliyuncs.com/doc/v1/">`)
+			for _, q := range []string{"app-orders", "app-users", "other"} {
+				if _, ok := queues[q]; ok && strings.HasPrefix(q, prefix) {
+					fmt.Fprintf(w, "<Queue><QueueURL>http://%s/%s</QueueURL></Queue>", r.Host, q)
+				}
+			}
+			fmt.Fprint(w, `</Queues>`)
+			return
+		}
+		active, ok := queues[name]
+		if !ok {
+			w.WriteHeader(404)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Error xmlns="http://mqs.aliyuncs.com/doc/v1/"><Code>QueueNotExist</Code><Message>QueueNotExist</Message><RequestId>0</RequestId><HostId>fake</HostId></Error>`)
+			return
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Queue xmlns="http://mqs.aliyuncs.com/doc/v1/"><QueueName>%s</QueueName><DelaySeconds>0</DelaySeconds><MaximumMessageSize>65536</MaximumMessageSize><MessageRetentionPeriod>345600</MessageRetentionPeriod><VisibilityTimeout>30</VisibilityTimeout><PollingWaitSeconds>0</PollingWaitSeconds><ActiveMessages>%d</ActiveMessages><InactiveMessages>0</InactiveMessages><DelayMessages>0</DelayMessages></Queue>`, name, active)
+	}))
+}
+
+// 服务地址为 http://127.0.0.1:port，拆分成 QueueOwnId 和 MqsUrl
+func newTestExporter(server *httptest.Server, prefixes, queues []string) *exporter {
+	e := &exporter{queue: &aliyunMQS.Queue{}, prefixes: prefixes, queues: queues}
+	host := strings.TrimPrefix(server.URL, "http://")
+	i := strings.Index(host, ".")
+	e.queue.NewMQS("key", "secret", host[:i], host[i+1:])
+	return e
+}
+
+func metrics(e *exporter) string {
+	recorder := httptest.NewRecorder()
+	e.serveMetrics(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	return recorder.Body.String()
+}
+
+func TestExporter(t *testing.T) {
+	Convey("exporter测试", t, func() {
+		server := newFakeMQS(map[string]int{"app-orders": 3, "app-users": 0, "other": 7})
+		defer server.Close()
+
+		Convey("按前缀发现队列并输出指标", func() {
+			e := newTestExporter(server, []string{"app-"}, nil)
+			e.scrape()
+			output := metrics(e)
+			So(output, ShouldContainSubstring, "# TYPE mqs_queue_active_messages gauge\n")
+			So(output, ShouldContainSubstring, "mqs_queue_active_messages{queue=\"app-orders\"} 3\n")
+			So(output, ShouldContainSubstring, "mqs_queue_active_messages{queue=\"app-users\"} 0\n")
+			So(output, ShouldContainSubstring, "mqs_queue_visibility_timeout_seconds{queue=\"app-orders\"} 30\n")
+			So(output, ShouldNotContainSubstring, "other")
+			So(output, ShouldContainSubstring, "mqs_scrape_success 1\n")
+			So(output, ShouldContainSubstring, "mqs_scrape_timestamp_seconds ")
+		})
+
+		Convey("单个队列失败时跳过并记为失败", func() {
+			e := newTestExporter(server, nil, []string{"other", "missing"})
+			e.scrape()
+			output := metrics(e)
+			So(output, ShouldContainSubstring, "mqs_queue_active_messages{queue=\"other\"} 7\n")
+			So(output, ShouldNotContainSubstring, "missing")
+			So(output, ShouldContainSubstring, "mqs_scrape_success 0\n")
+		})
+
+		Convey("采集之前只输出采集状态", func() {
+			output := metrics(newTestExporter(server, nil, nil))
+			So(output, ShouldContainSubstring, "mqs_scrape_success 0\n")
+			So(output, ShouldNotContainSubstring, "mqs_scrape_timestamp_seconds")
+		})
+
+		Convey("标签值按Prometheus文本格式转义", func() {
+			e := newTestExporter(server, nil, nil)
+			e.attrs = []*aliyunMQS.QueueAttributes{{QueueName: "a\\b\"c\nd\té"}}
+			So(metrics(e), ShouldContainSubstring, "mqs_queue_active_messages{queue=\"a\\\\b\\\"c\\nd\té\"} 0\n")
+		})
+	})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/congjunwei/aliyunMQS"
+	"gopkg.in/yaml.v3"
+)
+
+// 队列声明文件
+//
+//	Prefix: app-
+//	Queues:
+//	  - Name: app-orders
+//	    VisibilityTimeout: 60
+type queuesFile struct {
+	// 只管理以此前缀开头的队列，-prune 时删除范围内未声明的队列
+	Prefix string                   `yaml:"Prefix"`
+	Queues []*aliyunMQS.QueueConfig `yaml:"Queues"`
+}
+
+func apply(args []string) error {
+	flags, c := newFlagSet("apply")
+	file := flags.String("f", "", "队列声明文件(YAML)")
+	prune := flags.Bool("prune", false, "删除前缀范围内未声明的队列，声明文件必须指定 Prefix")
+	pruneAll := flags.Bool("prune-all", false, "声明文件没有 Prefix 时删除账号下所有未声明的队列")
+	yes := flags.Bool("yes", false, "不确认直接执行")
+	flags.Parse(args)
+	if *file == "" {
+		return errors.New("必须指定 -f")
+	}
+	content, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	declared := &queuesFile{}
+	if err := yaml.Unmarshal(content, declared); err != nil {
+		return fmt.Errorf("%s: %w", *file, err)
+	}
+
+	queue := c.queue()
+	plan, err := queue.Plan(declared.Queues, aliyunMQS.PlanOptions{Prefix: declared.Prefix, Prune: *prune || *pruneAll, PruneAll: *pruneAll})
+	if err != nil {
+		return err
+	}
+	if plan.Empty() {
+		fmt.Println("没有变化")
+		return nil
+	}
+	fmt.Print(plan)
+	if !*yes && !confirm("执行以上变更?") {
+		return errors.New("已取消")
+	}
+	if err := queue.Apply(plan); err != nil {
+		return err
+	}
+	fmt.Printf("已执行%d项变更\n", len(plan.Items))
+	return nil
+}
+
+// 在终端确认，输入 yes 时返回true
+func confirm(prompt string) bool {
+	fmt.Printf("%s 输入 yes 确认: ", prompt)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(line) == "yes"
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/congjunwei/aliyunMQS"
+	"gopkg.in/yaml.v3"
+)
+
+func backup(args []string) error {
+	flags, c := newFlagSet("backup")
+	prefix := flags.String("prefix", "", "只备份以此前缀开头的队列")
+	output := flags.String("o", "", "备份文件，扩展名为 .yaml/.yml 时使用YAML，否则使用JSON")
+	flags.Parse(args)
+	if *output == "" {
+		return errors.New("必须指定 -o")
+	}
+	backup, err := c.queue().Backup(*prefix)
+	if err != nil {
+		return err
+	}
+	var content []byte
+	if isYAML(*output) {
+		content, err = yaml.Marshal(backup)
+	} else {
+		content, err = json.MarshalIndent(backup, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*output, content, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("已备份%d个队列到%s\n", len(backup.Queues), *output)
+	return nil
+}
+
+func restore(args []string) error {
+	flags, c := newFlagSet("restore")
+	file := flags.String("f", "", "备份文件")
+	policy := flags.String("policy", "skip", "已存在队列的处理方式: skip 或 overwrite")
+	flags.Parse(args)
+	if *file == "" {
+		return errors.New("必须指定 -f")
+	}
+	var p aliyunMQS.RestorePolicy
+	switch *policy {
+	case "skip":
+		p = aliyunMQS.RestoreSkip
+	case "overwrite":
+		p = aliyunMQS.RestoreOverwrite
+	default:
+		return fmt.Errorf("未知的 -policy %s", *policy)
+	}
+	content, err := os.ReadFile(*file)
+	if err != nil {
+		return err
+	}
+	backup := &aliyunMQS.QueueBackup{}
+	if isYAML(*file) {
+		err = yaml.Unmarshal(content, backup)
+	} else {
+		err = json.Unmarshal(content, backup)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", *file, err)
+	}
+	result, err := c.queue().Restore(backup, p)
+	fmt.Printf("创建%d个，覆盖%d个，跳过%d个\n", len(result.Created), len(result.Overwritten), len(result.Skipped))
+	return err
+}
+
+func isYAML(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".yaml" || ext == ".yml"
+}
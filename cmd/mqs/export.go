@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/congjunwei/aliyunMQS"
+)
+
+func export(args []string) error {
+	flags, c := newFlagSet("export")
+	queuename := flags.String("queue", "", "队列名称")
+	output := flags.String("o", "-", "输出文件(JSON Lines)，- 表示标准输出")
+	snapshot := flags.Bool("snapshot", false, "不删除消息，结束时恢复可见。-limit 1 时用 PeekMessage 没有副作用；"+
+		"否则导出期间消息对消费者不可见，每条消息的 DequeueCount 加1，可能使消息提前进入死信队列")
+	limit := flags.Int("limit", 0, "最多导出的消息数，0表示直到队列为空")
+	maxDeliveries := flags.Int("max-deliveries", 0, "消费者死信策略的 MaxDeliveries，大于0时拒绝 -snapshot")
+	yes := flags.Bool("yes", false, "-snapshot 时不确认直接执行")
+	flags.Parse(args)
+	if *queuename == "" {
+		return errors.New("必须指定 -queue")
+	}
+	opts := aliyunMQS.ExportOptions{Mode: aliyunMQS.ExportDrain, Limit: *limit}
+	if *snapshot {
+		opts.Mode = aliyunMQS.ExportSnapshot
+		if *maxDeliveries > 0 {
+			opts.DeadLetter = &aliyunMQS.DeadLetterPolicy{MaxDeliveries: *maxDeliveries}
+		}
+		if *limit != 1 && opts.DeadLetter == nil && !*yes &&
+			!confirm("快照会使每条消息的 DequeueCount 加1，导出期间消息对消费者不可见。队列有死信策略时可能把未处理的消息转入死信队列。") {
+			return errors.New("已取消")
+		}
+	}
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	n, err := c.message().Export(ctx, *queuename, w, opts)
+	fmt.Fprintf(os.Stderr, "已导出%d条消息\n", n)
+	return err
+}
+
+func importMessages(args []string) error {
+	flags, c := newFlagSet("import")
+	queuename := flags.String("queue", "", "队列名称")
+	input := flags.String("f", "-", "由 export 导出的文件，- 表示标准输入")
+	rate := flags.Float64("rate", 10, "每秒最多发送的消息数，0表示不限")
+	flags.Parse(args)
+	if *queuename == "" {
+		return errors.New("必须指定 -queue")
+	}
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	n, err := c.message().Import(ctx, *queuename, r, aliyunMQS.ImportOptions{Rate: *rate})
+	fmt.Fprintf(os.Stderr, "已导入%d条消息\n", n)
+	return err
+}
@@ -0,0 +1,94 @@
+// mqs 是 aliyunMQS 的命令行工具
+//
+// 用法: mqs <命令> [参数]
+//
+// 访问凭证可以通过参数或环境变量 MQS_ACCESS_KEY、MQS_ACCESS_SECRET、
+// MQS_QUEUE_OWNER_ID、MQS_URL 指定。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/congjunwei/aliyunMQS"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"apply":   {"按YAML声明创建、修改、删除队列", apply},
+	"backup":  {"备份所有队列的配置到JSON/YAML文件", backup},
+	"clone":   {"按已有队列的属性创建新队列", clone},
+	"export":  {"把队列中的消息导出为JSON Lines", export},
+	"import":  {"把导出的消息发送到队列", importMessages},
+	"migrate": {"把消息迁移到其他队列、账号或地域", migrate},
+	"purge":   {"删除队列中的所有消息，保留队列属性", purge},
+	"redrive": {"把死信队列中的消息重新投递到原队列", redrive},
+	"restore": {"按备份文件创建队列", restore},
+	"rename":  {"重命名队列，中断后可以继续", rename},
+	"resize":  {"调整分区队列的分区数", resize},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, "mqs:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "用法: mqs <命令> [参数]")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].usage)
+	}
+}
+
+// 访问凭证
+type config struct {
+	accessKey    string
+	accessSecret string
+	queueOwnId   string
+	mqsUrl       string
+}
+
+// 创建带访问凭证参数的FlagSet
+func newFlagSet(name string) (*flag.FlagSet, *config) {
+	c := &config{}
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	flags.StringVar(&c.accessKey, "access-key", os.Getenv("MQS_ACCESS_KEY"), "AccessKey")
+	flags.StringVar(&c.accessSecret, "access-secret", os.Getenv("MQS_ACCESS_SECRET"), "AccessSecret")
+	flags.StringVar(&c.queueOwnId, "owner-id", os.Getenv("MQS_QUEUE_OWNER_ID"), "QueueOwnerId")
+	flags.StringVar(&c.mqsUrl, "endpoint", os.Getenv("MQS_URL"), "MQS服务地址，如 mqs-cn-beijing.aliyuncs.com")
+	return flags, c
+}
+
+func (c *config) message() *aliyunMQS.Message {
+	msg := &aliyunMQS.Message{}
+	msg.NewMQS(c.accessKey, c.accessSecret, c.queueOwnId, c.mqsUrl)
+	return msg
+}
+
+func (c *config) queue() *aliyunMQS.Queue {
+	queue := &aliyunMQS.Queue{}
+	queue.NewMQS(c.accessKey, c.accessSecret, c.queueOwnId, c.mqsUrl)
+	return queue
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/congjunwei/aliyunMQS"
+)
+
+func migrate(args []string) error {
+	flags, c := newFlagSet("migrate")
+	source := flags.String("queue", "", "源队列名称")
+	destination := flags.String("to", "", "目标队列名称")
+	// 目标账号或地域，未指定的使用源队列的访问凭证
+	target := &config{}
+	flags.StringVar(&target.accessKey, "to-access-key", "", "目标队列的AccessKey")
+	flags.StringVar(&target.accessSecret, "to-access-secret", "", "目标队列的AccessSecret")
+	flags.StringVar(&target.queueOwnId, "to-owner-id", "", "目标队列的QueueOwnerId")
+	flags.StringVar(&target.mqsUrl, "to-endpoint", "", "目标队列的MQS服务地址")
+	concurrency := flags.Int("concurrency", 4, "并发数")
+	limit := flags.Int("limit", 0, "最多迁移的消息数，0表示直到源队列为空")
+	flags.Parse(args)
+	if *source == "" || *destination == "" {
+		return errors.New("必须指定 -queue 和 -to")
+	}
+	inherit := func(v *string, from string) {
+		if *v == "" {
+			*v = from
+		}
+	}
+	inherit(&target.accessKey, c.accessKey)
+	inherit(&target.accessSecret, c.accessSecret)
+	inherit(&target.queueOwnId, c.queueOwnId)
+	inherit(&target.mqsUrl, c.mqsUrl)
+	if *target == *c && *source == *destination {
+		return errors.New("源队列和目标队列相同")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts := aliyunMQS.MigrateOptions{
+		Concurrency:      *concurrency,
+		Limit:            *limit,
+		ProgressInterval: 5 * time.Second,
+		Progress: func(p aliyunMQS.MigrateResult) {
+			fmt.Printf("received=%d migrated=%d failed=%d\n", p.Received, p.Migrated, p.Failed)
+		},
+	}
+	_, err := aliyunMQS.Migrate(ctx, c.message(), *source, target.message(), *destination, opts)
+	return err
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/congjunwei/aliyunMQS"
+)
+
+func purge(args []string) error {
+	flags, c := newFlagSet("purge")
+	queuename := flags.String("queue", "", "队列名称")
+	timeout := flags.Duration("timeout", 10*time.Minute, "最长执行时间")
+	concurrency := flags.Int("concurrency", 4, "并发数")
+	yes := flags.Bool("yes", false, "不确认直接执行")
+	flags.Parse(args)
+	if *queuename == "" {
+		return errors.New("必须指定 -queue")
+	}
+	queue := c.queue()
+	attrs, err := queue.Attributes(*queuename)
+	if err != nil {
+		return err
+	}
+	if !*yes && !confirm(fmt.Sprintf("删除队列%s中的%d条消息?", *queuename, attrs.ActiveMessages)) {
+		return errors.New("已取消")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	n, err := queue.PurgeQueue(ctx, *queuename, aliyunMQS.PurgeOptions{Concurrency: *concurrency, Timeout: *timeout})
+	fmt.Printf("已删除%d条消息\n", n)
+	return err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/congjunwei/aliyunMQS"
+)
+
+func redrive(args []string) error {
+	flags, c := newFlagSet("redrive")
+	deadletter := flags.String("queue", "", "死信队列名称")
+	to := flags.String("to", "", "没有记录原队列的消息投递到此队列")
+	source := flags.String("source", "", "只投递来自此队列的消息")
+	reason := flags.String("reason", "", "只投递失败原因包含此字符串的消息")
+	rate := flags.Float64("rate", 10, "每秒最多投递的消息数，0表示不限")
+	limit := flags.Int("limit", 0, "最多处理的消息数，0表示直到死信队列为空")
+	dryrun := flags.Bool("dry-run", false, "只统计不投递")
+	flags.Parse(args)
+	if *deadletter == "" {
+		return errors.New("必须指定 -queue")
+	}
+
+	opts := aliyunMQS.RedriveOptions{DefaultQueue: *to, Rate: *rate, Limit: *limit, DryRun: *dryrun}
+	if *source != "" || *reason != "" {
+		opts.Filter = func(msg *aliyunMQS.ReceivedMessage) bool {
+			if *source != "" && msg.Header(aliyunMQS.HeaderDLQSourceQueue) != *source {
+				return false
+			}
+			return strings.Contains(msg.Header(aliyunMQS.HeaderDLQReason), *reason)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	result, err := c.message().Redrive(ctx, *deadletter, opts)
+	if result != nil {
+		fmt.Printf("received=%d redriven=%d skipped=%d failed=%d\n", result.Received, result.Redriven, result.Skipped, result.Failed)
+	}
+	return err
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/congjunwei/aliyunMQS"
+)
+
+func clone(args []string) error {
+	flags, c := newFlagSet("clone")
+	source := flags.String("queue", "", "已有队列名称")
+	target := flags.String("to", "", "新队列名称")
+	flags.Parse(args)
+	if *source == "" || *target == "" {
+		return errors.New("必须指定 -queue 和 -to")
+	}
+	return c.queue().CloneQueue(*source, *target)
+}
+
+func rename(args []string) error {
+	flags, c := newFlagSet("rename")
+	source := flags.String("queue", "", "原队列名称")
+	target := flags.String("to", "", "新队列名称")
+	statefile := flags.String("state", "", "状态文件，默认为 rename-<原队列>-<新队列>.json")
+	concurrency := flags.Int("concurrency", 4, "迁移消息的并发数")
+	yes := flags.Bool("yes", false, "不等待确认切换")
+	flags.Parse(args)
+	if *source == "" || *target == "" {
+		return errors.New("必须指定 -queue 和 -to")
+	}
+	if *statefile == "" {
+		*statefile = fmt.Sprintf("rename-%s-%s.json", *source, *target)
+	}
+
+	opts := aliyunMQS.RenameOptions{StateFile: *statefile, Concurrency: *concurrency}
+	opts.SwitchOver = func(ctx context.Context) error {
+		if *yes || confirm(fmt.Sprintf("消息已迁移到%s，请把生产者和消费者切换到新队列。", *target)) {
+			return nil
+		}
+		return errors.New("未切换，再次执行时继续")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	state, err := c.queue().RenameQueue(ctx, *source, *target, opts)
+	if state != nil {
+		fmt.Printf("step=%s migrated=%d\n", state.Step, state.Migrated)
+	}
+	return err
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/congjunwei/aliyunMQS"
+)
+
+func resize(args []string) error {
+	flags, c := newFlagSet("resize")
+	name := flags.String("queue", "", "分区队列的逻辑名称")
+	from := flags.Int("from", 0, "当前分区数")
+	to := flags.Int("to", 0, "新的分区数")
+	flags.Parse(args)
+	if *name == "" || *from <= 0 || *to <= 0 {
+		return errors.New("必须指定 -queue、-from 和 -to")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	partitioned := aliyunMQS.NewPartitionedQueue(c.queue(), c.message(), *name, *from)
+	if err := partitioned.Resize(ctx, *to, nil); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d -> %d\n", *name, *from, *to)
+	return nil
+}
@@ -0,0 +1,184 @@
+package aliyunMQS
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// 消息处理函数，返回nil时消息被删除
+type Handler func(msg *ReceivedMessage) error
+
+// 消费者，循环调用 ReceiveMessage 长轮询队列并把消息交给 Handler 处理
+type Consumer struct {
+	Message   *Message
+	QueueName string
+	Handler   Handler
+	// ReceiveMessage 的长轮询等待时间,单位为秒
+	WaitSeconds int
+	// 死信策略，为nil时失败的消息一直重试
+	DeadLetter *DeadLetterPolicy
+	// 处理失败后按 DequeueCount 退避重试，为nil时等待队列的 VisibilityTimeout
+	Backoff *Backoff
+	// 已取消消息的墓碑，为nil时不检查
+	Tombstones TombstoneStore
+	// 请求出错后等待多久再次请求
+	ErrorBackoff time.Duration
+}
+
+// @Title 创建一个消费者
+// @Param msg 		消息客户端
+// @Param queuename	队列名称
+// @Param handler 	消息处理函数
+func NewConsumer(msg *Message, queuename string, handler Handler) *Consumer {
+	return &Consumer{
+		Message:      msg,
+		QueueName:    queuename,
+		Handler:      handler,
+		WaitSeconds:  30,
+		ErrorBackoff: time.Second,
+	}
+}
+
+// @Title 持续消费消息，直到ctx被取消
+func (this *Consumer) Run(ctx context.Context) error {
+	if this.Message.Signer != nil {
+		if err := this.Message.Signer.Validate(); err != nil {
+			return err
+		}
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		msg, err := this.Message.Receive(this.QueueName, this.WaitSeconds)
+		if err != nil {
+			var oerr *OpenError
+			if errors.As(err, &oerr) {
+				log.Printf("%v", err)
+				if rerr := this.rejectUnopened(oerr); rerr != nil {
+					log.Printf("队列%s消息%s处理失败: %v", this.QueueName, oerr.Message.MessageId, rerr)
+				}
+				continue
+			}
+			if errors.Is(err, ErrInvalidSignature) {
+				continue
+			}
+			if IsMessageNotExist(err) {
+				if wait := emptyPollWait(this.WaitSeconds, this.ErrorBackoff); wait > 0 && !sleep(ctx, wait) {
+					return ctx.Err()
+				}
+				continue
+			}
+			log.Printf("队列%s接收消息失败: %v", this.QueueName, err)
+			if !sleep(ctx, this.ErrorBackoff) {
+				return ctx.Err()
+			}
+			continue
+		}
+		if err := this.Process(msg); err != nil {
+			log.Printf("队列%s消息%s处理失败: %v", this.QueueName, msg.MessageId, err)
+		}
+	}
+}
+
+// @Title 处理一条消息：已取消的直接删除，未到投递时间的重新延迟，超过投递次数的转发到死信队列，处理成功后删除
+// @Param msg 通过 Receive 获得的消息
+func (this *Consumer) Process(msg *ReceivedMessage) error {
+	if handled, err := this.Message.preprocess(this.QueueName, msg, this.Tombstones); handled || err != nil {
+		return err
+	}
+	if this.DeadLetter != nil && this.DeadLetter.Exceeded(msg) {
+		return this.Message.DeadLetter(this.QueueName, msg, this.DeadLetter.Queue, "超过最大投递次数")
+	}
+	if err := this.Handler(msg); err != nil {
+		if this.DeadLetter != nil && this.DeadLetter.Exhausted(msg) {
+			if derr := this.Message.DeadLetter(this.QueueName, msg, this.DeadLetter.Queue, err.Error()); derr != nil {
+				return derr
+			}
+		} else if this.Backoff != nil {
+			if nerr := msg.Nack(this.Backoff.Delay(msg.DequeueCount)); nerr != nil {
+				return nerr
+			}
+		}
+		return err
+	}
+	_, err := this.Message.DeleteMessage(this.QueueName, msg.ReceiptHandle)
+	return err
+}
+
+// 已取消的消息直接删除，未到投递时间的消息重新延迟，返回true表示消息不应再交给处理函数
+func (this *Message) preprocess(queuename string, msg *ReceivedMessage, tombstones TombstoneStore) (bool, error) {
+	if tombstones != nil {
+		cancelled, err := tombstones.Contains(msg.OriginMessageId())
+		if err != nil {
+			return false, err
+		}
+		if cancelled {
+			_, err := this.DeleteMessage(queuename, msg.ReceiptHandle)
+			return true, err
+		}
+	}
+	return this.Reschedule(queuename, msg)
+}
+
+// 处理无法解密的消息，与处理失败相同：达到死信策略的投递次数后把原始消息转发到死信队列，
+// 否则按 Backoff 延后重新投递
+func (this *Consumer) rejectUnopened(oerr *OpenError) error {
+	msg := oerr.Message
+	if this.DeadLetter != nil && this.DeadLetter.Exhausted(msg) {
+		return this.Message.deadLetter(this.QueueName, msg, this.DeadLetter.Queue, oerr.Err.Error(), false)
+	}
+	if this.Backoff != nil {
+		return msg.Nack(this.Backoff.Delay(msg.DequeueCount))
+	}
+	return nil
+}
+
+// ErrorBackoff 为0时短轮询收到空结果后的等待时间
+const emptyPollInterval = 100 * time.Millisecond
+
+// 短轮询(waitseconds为0)时队列为空后等待多久再次请求，避免连续请求空队列；长轮询时不等待
+func emptyPollWait(waitseconds int, errorbackoff time.Duration) time.Duration {
+	if waitseconds > 0 {
+		return 0
+	}
+	if errorbackoff > 0 {
+		return errorbackoff
+	}
+	return emptyPollInterval
+}
+
+// 等待d，ctx被取消时返回false
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// @Title 同时运行多个消费者，直到ctx被取消或任一消费者返回
+func RunConsumers(ctx context.Context, consumers ...*Consumer) error {
+	if len(consumers) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errs := make(chan error, len(consumers))
+	for _, c := range consumers {
+		go func(c *Consumer) {
+			errs <- c.Run(ctx)
+		}(c)
+	}
+	err := <-errs
+	cancel()
+	for i := 1; i < len(consumers); i++ {
+		<-errs
+	}
+	return err
+}
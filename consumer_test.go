@@ -0,0 +1,95 @@
+package aliyunMQS
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConsumer(t *testing.T) {
+	Convey("消费者测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		queue.CreateQueue("orders", nil)
+		queue.CreateQueue("orders-dlq", nil)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+
+		Convey("处理成功后删除消息", func() {
+			msg.SendMessage("orders", "o1", nil)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			received := make(chan string, 1)
+			consumer := NewConsumer(&msg, "orders", func(m *ReceivedMessage) error {
+				received <- m.MessageBody
+				cancel()
+				return nil
+			})
+			consumer.WaitSeconds = 0
+			consumer.ErrorBackoff = 10 * time.Millisecond
+			So(consumer.Run(ctx), ShouldEqual, context.Canceled)
+			So(<-received, ShouldEqual, "o1")
+			So(mock.count("orders"), ShouldEqual, 0)
+		})
+
+		Convey("空队列返回MessageNotExist", func() {
+			_, err := msg.Receive("orders", 0)
+			So(IsMessageNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("短轮询空队列时等待后再请求", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			consumer := NewConsumer(&msg, "orders", func(m *ReceivedMessage) error { return nil })
+			consumer.WaitSeconds = 0
+			consumer.ErrorBackoff = 50 * time.Millisecond
+			start := mock.requestCount()
+			So(consumer.Run(ctx), ShouldEqual, context.DeadlineExceeded)
+			So(mock.requestCount()-start, ShouldBeLessThanOrEqualTo, 5)
+		})
+
+		Convey("达到最大投递次数后转发到死信队列", func() {
+			msg.SendMessage("orders", "poison", map[string]int{"Priority": 3})
+			consumer := NewConsumer(&msg, "orders", func(m *ReceivedMessage) error {
+				return errors.New("boom")
+			})
+			consumer.DeadLetter = &DeadLetterPolicy{Queue: "orders-dlq", MaxDeliveries: 2}
+
+			for i := 0; i < 2; i++ {
+				m, err := msg.Receive("orders", 0)
+				So(err, ShouldBeNil)
+				So(consumer.Process(m), ShouldNotBeNil)
+				mock.expire("orders")
+			}
+			So(mock.count("orders"), ShouldEqual, 0)
+
+			dead, err := msg.Receive("orders-dlq", 0)
+			So(err, ShouldBeNil)
+			So(dead.MessageBody, ShouldEqual, "poison")
+			So(dead.Priority, ShouldEqual, 3)
+			So(dead.Header(HeaderDLQReason), ShouldEqual, "boom")
+			So(dead.Header(HeaderDLQSourceQueue), ShouldEqual, "orders")
+			So(dead.Header(HeaderDLQDequeueCount), ShouldEqual, "2")
+		})
+
+		Convey("超过最大投递次数的消息不再处理", func() {
+			msg.SendMessage("orders", "stale", nil)
+			m, _ := msg.Receive("orders", 0)
+			m.DequeueCount = 5
+			called := false
+			consumer := NewConsumer(&msg, "orders", func(m *ReceivedMessage) error {
+				called = true
+				return nil
+			})
+			consumer.DeadLetter = &DeadLetterPolicy{Queue: "orders-dlq", MaxDeliveries: 2}
+			So(consumer.Process(m), ShouldBeNil)
+			So(called, ShouldBeFalse)
+			So(mock.count("orders-dlq"), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,307 @@
+package aliyunMQS
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+const encAlgorithm = "AES-256-GCM"
+
+// 密钥提供者，负责生成数据密钥以及解密被主密钥加密的数据密钥
+type KeyProvider interface {
+	// 生成一个新的数据密钥，返回主密钥id、明文数据密钥和被主密钥加密后的数据密钥
+	GenerateDataKey() (keyid string, plaintext, encrypted []byte, err error)
+	// 用 keyid 对应的主密钥解密数据密钥
+	DecryptDataKey(keyid string, encrypted []byte) ([]byte, error)
+}
+
+// 配置了 Encryptor 时收到未加密的消息，可用 errors.Is 判断
+var ErrNotEncrypted = errors.New("消息未加密")
+
+// 收到的消息无法解密(未加密或解密失败)。Message 为未解密的原始消息，
+// 可以转发到死信队列或删除，可用 errors.As 获取
+type OpenError struct {
+	Message *ReceivedMessage
+	Err     error
+}
+
+func (this *OpenError) Error() string {
+	return fmt.Sprintf("队列%s消息%s解密失败: %v", this.Message.queuename, this.Message.MessageId, this.Err)
+}
+
+func (this *OpenError) Unwrap() error {
+	return this.Err
+}
+
+// 消息正文的信封加密，每条消息使用独立的数据密钥
+type Encryptor struct {
+	Provider KeyProvider
+	// 允许接收未加密的消息，原样返回。默认拒绝，用于从明文迁移到加密期间
+	AllowPlaintext bool
+}
+
+// @Title 创建一个信封加密器
+// @Param provider 密钥提供者
+func NewEncryptor(provider KeyProvider) *Encryptor {
+	return &Encryptor{Provider: provider}
+}
+
+// @Title 加密信封正文，并把key id和加密后的数据密钥写入信封头
+// @Param env 信封
+func (this *Encryptor) Seal(env *Envelope) error {
+	keyid, datakey, encrypted, err := this.Provider.GenerateDataKey()
+	if err != nil {
+		return err
+	}
+	ciphertext, err := gcmSeal(datakey, []byte(env.Body), []byte(keyid))
+	if err != nil {
+		return err
+	}
+	env.Set(HeaderEncAlgorithm, encAlgorithm)
+	env.Set(HeaderEncKeyId, keyid)
+	env.Set(HeaderEncDataKey, base64.StdEncoding.EncodeToString(encrypted))
+	env.Body = base64.StdEncoding.EncodeToString(ciphertext)
+	return nil
+}
+
+// @Title 解密信封正文，信封未加密时返回 ErrNotEncrypted，AllowPlaintext 时不做处理
+// @Param env 信封
+func (this *Encryptor) Open(env *Envelope) error {
+	keyid := env.Get(HeaderEncKeyId)
+	if keyid == "" {
+		if this.AllowPlaintext {
+			return nil
+		}
+		return ErrNotEncrypted
+	}
+	if alg := env.Get(HeaderEncAlgorithm); alg != encAlgorithm {
+		return errors.New("不支持的加密算法:" + alg)
+	}
+	encrypted, err := base64.StdEncoding.DecodeString(env.Get(HeaderEncDataKey))
+	if err != nil {
+		return err
+	}
+	datakey, err := this.Provider.DecryptDataKey(keyid, encrypted)
+	if err != nil {
+		return err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(env.Body)
+	if err != nil {
+		return err
+	}
+	plaintext, err := gcmOpen(datakey, ciphertext, []byte(keyid))
+	if err != nil {
+		return err
+	}
+	env.Body = string(plaintext)
+	env.Del(HeaderEncAlgorithm)
+	env.Del(HeaderEncKeyId)
+	env.Del(HeaderEncDataKey)
+	return nil
+}
+
+// 本地密钥环，主密钥保存在文件中。
+// 轮换密钥时新增一个主密钥并设为 Primary，旧密钥保留用于解密历史消息
+type Keyring struct {
+	Primary string            `json:"primary"`
+	Keys    map[string]string `json:"keys"`
+
+	lock sync.RWMutex
+}
+
+// @Title 创建一个空的密钥环
+func NewKeyring() *Keyring {
+	return &Keyring{Keys: map[string]string{}}
+}
+
+// @Title 从文件加载密钥环
+// @Param path 文件路径
+func LoadKeyring(path string) (*Keyring, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keyring := NewKeyring()
+	if err := json.Unmarshal(content, keyring); err != nil {
+		return nil, err
+	}
+	if _, ok := keyring.Keys[keyring.Primary]; !ok {
+		return nil, errors.New("密钥环中不存在主密钥:" + keyring.Primary)
+	}
+	return keyring, nil
+}
+
+// @Title 保存密钥环到文件
+// @Param path 文件路径
+func (this *Keyring) Save(path string) error {
+	this.lock.RLock()
+	content, err := json.MarshalIndent(this, "", "  ")
+	this.lock.RUnlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0600)
+}
+
+// @Title 添加一个主密钥，密钥环为空时设为 Primary
+// @Param keyid 密钥id
+// @Param key 	密钥，长度为16/24/32字节
+func (this *Keyring) AddKey(keyid string, key []byte) error {
+	if _, err := aes.NewCipher(key); err != nil {
+		return err
+	}
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if _, ok := this.Keys[keyid]; ok {
+		return errors.New("密钥已存在:" + keyid)
+	}
+	this.Keys[keyid] = base64.StdEncoding.EncodeToString(key)
+	if this.Primary == "" {
+		this.Primary = keyid
+	}
+	return nil
+}
+
+// @Title 轮换密钥，生成新的主密钥并设为 Primary
+// @Param keyid 新密钥id
+func (this *Keyring) Rotate(keyid string) error {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+	if err := this.AddKey(keyid, key); err != nil {
+		return err
+	}
+	this.lock.Lock()
+	this.Primary = keyid
+	this.lock.Unlock()
+	return nil
+}
+
+// @Title 删除一个不再使用的主密钥，不能删除 Primary
+// @Param keyid 密钥id
+func (this *Keyring) RemoveKey(keyid string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if keyid == this.Primary {
+		return errors.New("不能删除主密钥:" + keyid)
+	}
+	delete(this.Keys, keyid)
+	return nil
+}
+
+// @Title 列出所有密钥id
+func (this *Keyring) KeyIds() []string {
+	this.lock.RLock()
+	defer this.lock.RUnlock()
+	keyids := make([]string, 0, len(this.Keys))
+	for k := range this.Keys {
+		keyids = append(keyids, k)
+	}
+	sort.Strings(keyids)
+	return keyids
+}
+
+func (this *Keyring) masterKey(keyid string) ([]byte, error) {
+	this.lock.RLock()
+	encoded, ok := this.Keys[keyid]
+	this.lock.RUnlock()
+	if !ok {
+		return nil, errors.New("未找到密钥:" + keyid)
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+func (this *Keyring) GenerateDataKey() (string, []byte, []byte, error) {
+	this.lock.RLock()
+	keyid := this.Primary
+	this.lock.RUnlock()
+	master, err := this.masterKey(keyid)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	datakey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, datakey); err != nil {
+		return "", nil, nil, err
+	}
+	encrypted, err := gcmSeal(master, datakey, []byte(keyid))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return keyid, datakey, encrypted, nil
+}
+
+func (this *Keyring) DecryptDataKey(keyid string, encrypted []byte) ([]byte, error) {
+	master, err := this.masterKey(keyid)
+	if err != nil {
+		return nil, err
+	}
+	return gcmOpen(master, encrypted, []byte(keyid))
+}
+
+// KMS 服务客户端，可以对接阿里云KMS或在测试中替换为桩实现
+type KMSClient interface {
+	// 用 keyid 对应的主密钥生成数据密钥，返回明文和密文
+	GenerateDataKey(keyid string) (plaintext, ciphertextblob []byte, err error)
+	// 解密数据密钥密文
+	Decrypt(keyid string, ciphertextblob []byte) ([]byte, error)
+}
+
+// 基于KMS的密钥提供者，轮换密钥时修改 KeyId 即可，历史消息仍按信封中的key id解密
+type KMSKeyProvider struct {
+	Client KMSClient
+	KeyId  string
+}
+
+func (this *KMSKeyProvider) GenerateDataKey() (string, []byte, []byte, error) {
+	plaintext, encrypted, err := this.Client.GenerateDataKey(this.KeyId)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return this.KeyId, plaintext, encrypted, nil
+}
+
+func (this *KMSKeyProvider) DecryptDataKey(keyid string, encrypted []byte) ([]byte, error) {
+	return this.Client.Decrypt(keyid, encrypted)
+}
+
+func gcmSeal(key, plaintext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func gcmOpen(key, ciphertext, aad []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("密文长度错误")
+	}
+	nonce := ciphertext[:gcm.NonceSize()]
+	return gcm.Open(nil, nonce, ciphertext[gcm.NonceSize():], aad)
+}
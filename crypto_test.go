@@ -0,0 +1,187 @@
+package aliyunMQS
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// KMS桩实现，用固定主密钥加密数据密钥
+type stubKMS struct {
+	keys map[string][]byte
+}
+
+func (this *stubKMS) GenerateDataKey(keyid string) ([]byte, []byte, error) {
+	master, ok := this.keys[keyid]
+	if !ok {
+		return nil, nil, errors.New("no key")
+	}
+	plaintext := []byte(strings.Repeat("d", 32))
+	ciphertext, err := gcmSeal(master, plaintext, nil)
+	return plaintext, ciphertext, err
+}
+
+func (this *stubKMS) Decrypt(keyid string, ciphertextblob []byte) ([]byte, error) {
+	master, ok := this.keys[keyid]
+	if !ok {
+		return nil, errors.New("no key")
+	}
+	return gcmOpen(master, ciphertextblob, nil)
+}
+
+func TestEncryptor(t *testing.T) {
+	Convey("信封加密测试", t, func() {
+		keyring := NewKeyring()
+		So(keyring.Rotate("k1"), ShouldBeNil)
+		encryptor := NewEncryptor(keyring)
+
+		Convey("加密后可以解密", func() {
+			env := NewEnvelope("敏感数据")
+			So(encryptor.Seal(env), ShouldBeNil)
+			So(env.Body, ShouldNotContainSubstring, "敏感数据")
+			So(env.Get(HeaderEncKeyId), ShouldEqual, "k1")
+			So(encryptor.Open(env), ShouldBeNil)
+			So(env.Body, ShouldEqual, "敏感数据")
+			So(env.Get(HeaderEncKeyId), ShouldEqual, "")
+		})
+
+		Convey("轮换密钥后仍能解密旧消息", func() {
+			env := NewEnvelope("old")
+			So(encryptor.Seal(env), ShouldBeNil)
+			So(keyring.Rotate("k2"), ShouldBeNil)
+			So(keyring.RemoveKey("k2"), ShouldNotBeNil)
+
+			fresh := NewEnvelope("new")
+			So(encryptor.Seal(fresh), ShouldBeNil)
+			So(fresh.Get(HeaderEncKeyId), ShouldEqual, "k2")
+			So(encryptor.Open(env), ShouldBeNil)
+			So(env.Body, ShouldEqual, "old")
+		})
+
+		Convey("密钥环保存和加载", func() {
+			path := filepath.Join(t.TempDir(), "keyring.json")
+			So(keyring.Save(path), ShouldBeNil)
+			loaded, err := LoadKeyring(path)
+			So(err, ShouldBeNil)
+			So(loaded.KeyIds(), ShouldResemble, []string{"k1"})
+
+			env := NewEnvelope("hello")
+			So(encryptor.Seal(env), ShouldBeNil)
+			So(NewEncryptor(loaded).Open(env), ShouldBeNil)
+			So(env.Body, ShouldEqual, "hello")
+		})
+
+		Convey("篡改密文解密失败", func() {
+			env := NewEnvelope("hello")
+			So(encryptor.Seal(env), ShouldBeNil)
+			ciphertext, _ := base64.StdEncoding.DecodeString(env.Body)
+			ciphertext[len(ciphertext)-1] ^= 1
+			env.Body = base64.StdEncoding.EncodeToString(ciphertext)
+			So(encryptor.Open(env), ShouldNotBeNil)
+		})
+
+		Convey("KMS密钥提供者", func() {
+			kms := &stubKMS{keys: map[string][]byte{"alias/a": []byte(strings.Repeat("a", 32))}}
+			encryptor := NewEncryptor(&KMSKeyProvider{Client: kms, KeyId: "alias/a"})
+			env := NewEnvelope("hello")
+			So(encryptor.Seal(env), ShouldBeNil)
+			So(env.Get(HeaderEncKeyId), ShouldEqual, "alias/a")
+			So(encryptor.Open(env), ShouldBeNil)
+			So(env.Body, ShouldEqual, "hello")
+		})
+	})
+}
+
+func TestEncryptedMessage(t *testing.T) {
+	Convey("加密消息收发测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		_, err := queue.CreateQueue("secure", nil)
+		So(err, ShouldBeNil)
+
+		keyring := NewKeyring()
+		So(keyring.Rotate("k1"), ShouldBeNil)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+		msg.Encryptor = NewEncryptor(keyring)
+
+		_, err = msg.SendMessage("secure", "身份证号", nil)
+		So(err, ShouldBeNil)
+
+		Convey("PeekMessage返回明文", func() {
+			var plain Message
+			mock.NewMQS(&plain.MQS)
+			raw, err := plain.PeekMessage("secure")
+			So(err, ShouldBeNil)
+			So(raw, ShouldNotContainSubstring, "身份证号")
+
+			content, err := msg.PeekMessage("secure")
+			So(err, ShouldBeNil)
+			So(content, ShouldContainSubstring, "身份证号")
+		})
+
+		Convey("拒绝未加密的消息", func() {
+			var plain Message
+			mock.NewMQS(&plain.MQS)
+			queue.CreateQueue("plain", nil)
+			plain.SendMessage("plain", "明文", nil)
+			env := NewEnvelope("明文信封")
+			plain.SendEnvelope("plain", env, nil)
+
+			_, err := msg.Receive("plain", 0)
+			So(errors.Is(err, ErrNotEncrypted), ShouldBeTrue)
+			_, err = msg.Receive("plain", 0)
+			So(errors.Is(err, ErrNotEncrypted), ShouldBeTrue)
+
+			mock.expire("plain")
+			msg.Encryptor.AllowPlaintext = true
+			received, err := msg.Receive("plain", 0)
+			So(err, ShouldBeNil)
+			So(received.MessageBody, ShouldStartWith, "明文")
+		})
+
+		Convey("无法解密的消息按死信策略转发", func() {
+			var plain Message
+			mock.NewMQS(&plain.MQS)
+			queue.CreateQueue("plain", nil)
+			queue.CreateQueue("plain-dlq", nil)
+			plain.SendMessage("plain", "明文", nil)
+
+			received, err := msg.Receive("plain", 0)
+			var oerr *OpenError
+			So(errors.As(err, &oerr), ShouldBeTrue)
+			So(oerr.Message, ShouldEqual, received)
+			So(received.MessageBody, ShouldEqual, "明文")
+			mock.expire("plain")
+
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			consumer := NewConsumer(&msg, "plain", func(m *ReceivedMessage) error { return nil })
+			consumer.WaitSeconds = 0
+			consumer.ErrorBackoff = 10 * time.Millisecond
+			consumer.DeadLetter = &DeadLetterPolicy{Queue: "plain-dlq", MaxDeliveries: 2}
+			So(consumer.Run(ctx), ShouldEqual, context.DeadlineExceeded)
+			So(mock.count("plain"), ShouldEqual, 0)
+
+			dead, err := plain.Receive("plain-dlq", 0)
+			So(err, ShouldBeNil)
+			So(dead.MessageBody, ShouldEqual, "明文")
+			So(dead.Header(HeaderDLQReason), ShouldEqual, ErrNotEncrypted.Error())
+		})
+
+		Convey("Receive返回解密后的消息", func() {
+			received, err := msg.Receive("secure", 0)
+			So(err, ShouldBeNil)
+			So(received.MessageBody, ShouldEqual, "身份证号")
+			So(received.ReceiptHandle, ShouldNotBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,82 @@
+package aliyunMQS
+
+import (
+	"strconv"
+	"time"
+)
+
+// 死信消息信封中记录的头信息名称
+const (
+	HeaderDLQSourceQueue      = "x-dlq-source-queue"
+	HeaderDLQReason           = "x-dlq-reason"
+	HeaderDLQMessageId        = "x-dlq-message-id"
+	HeaderDLQDequeueCount     = "x-dlq-dequeue-count"
+	HeaderDLQEnqueueTime      = "x-dlq-enqueue-time"
+	HeaderDLQFirstDequeueTime = "x-dlq-first-dequeue-time"
+	HeaderDLQPriority         = "x-dlq-priority"
+	HeaderDLQTime             = "x-dlq-time"
+)
+
+// 死信策略，消息投递次数达到 MaxDeliveries 后转发到死信队列
+type DeadLetterPolicy struct {
+	// 死信队列名称
+	Queue string
+	// 最大投递次数
+	MaxDeliveries int
+}
+
+// @Title 判断消息是否已经超过最大投递次数
+func (this *DeadLetterPolicy) Exceeded(msg *ReceivedMessage) bool {
+	return this.MaxDeliveries > 0 && msg.DequeueCount > this.MaxDeliveries
+}
+
+// @Title 判断消息本次处理失败后是否应转发到死信队列
+func (this *DeadLetterPolicy) Exhausted(msg *ReceivedMessage) bool {
+	return this.MaxDeliveries > 0 && msg.DequeueCount >= this.MaxDeliveries
+}
+
+// @Title 把消息连同失败原因和原始属性转发到死信队列，并从原队列删除
+// @Param queuename 	原队列名称
+// @Param msg 			通过 Receive 获得的消息
+// @Param deadletter 	死信队列名称
+// @Param reason 		失败原因
+func (this *Message) DeadLetter(queuename string, msg *ReceivedMessage, deadletter, reason string) error {
+	return this.deadLetter(queuename, msg, deadletter, reason, true)
+}
+
+// seal 为false时不加密签名，原样转发
+func (this *Message) deadLetter(queuename string, msg *ReceivedMessage, deadletter, reason string, seal bool) error {
+	if err := this.sendDeadLetter(queuename, msg, deadletter, reason, seal); err != nil {
+		return err
+	}
+	_, err := this.DeleteMessage(queuename, msg.ReceiptHandle)
+	return err
+}
+
+// 把消息转发到死信队列，不从原队列删除
+func (this *Message) sendDeadLetter(queuename string, msg *ReceivedMessage, deadletter, reason string, seal bool) error {
+	env := msg.forwardEnvelope()
+	env.Set(HeaderDLQSourceQueue, queuename)
+	env.Set(HeaderDLQReason, reason)
+	env.Set(HeaderDLQMessageId, msg.MessageId)
+	env.Set(HeaderDLQDequeueCount, strconv.Itoa(msg.DequeueCount))
+	env.Set(HeaderDLQEnqueueTime, strconv.FormatInt(msg.EnqueueTime, 10))
+	env.Set(HeaderDLQFirstDequeueTime, strconv.FormatInt(msg.FirstDequeueTime, 10))
+	env.Set(HeaderDLQPriority, strconv.Itoa(msg.Priority))
+	env.Set(HeaderDLQTime, strconv.FormatInt(time.Now().UnixNano()/1e6, 10))
+
+	param := map[string]int{}
+	if msg.Priority > 0 {
+		param["Priority"] = msg.Priority
+	}
+	if seal {
+		_, err := this.SendEnvelope(deadletter, env, param)
+		return err
+	}
+	messagebody, err := env.Encode()
+	if err != nil {
+		return err
+	}
+	_, err = this.sendMessage(deadletter, messagebody, param)
+	return err
+}
@@ -0,0 +1,198 @@
+package aliyunMQS
+
+import (
+	"container/list"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 信封中的幂等键，设置后消费端按此去重，否则按 MessageId 去重
+const HeaderIdempotencyKey = "x-idempotency-key"
+
+// 去重键的状态
+type DedupState int
+
+const (
+	// 首次出现，已占用
+	DedupNew DedupState = iota
+	// 正在被其他消费者处理
+	DedupProcessing
+	// 已经处理完成
+	DedupDone
+)
+
+var ErrDuplicateInFlight = errors.New("消息正在被其他消费者处理")
+
+// 去重存储
+type DedupStore interface {
+	// 占用key，lease 内未 Commit 或 Release 时自动释放。key已存在时返回其状态
+	Claim(key string, lease time.Duration) (DedupState, error)
+	// 标记key处理完成，保留 retention
+	Commit(key string, retention time.Duration) error
+	// 释放key，允许重新处理
+	Release(key string) error
+}
+
+// 幂等消费中间件，重复投递的消息不再交给 Handler
+type Dedup struct {
+	Store DedupStore
+	// 处理中的占用时间，应不短于队列的 VisibilityTimeout
+	Lease time.Duration
+	// 处理完成后记录的保留时间
+	Retention time.Duration
+}
+
+// @Title 创建幂等消费中间件
+// @Param store 		去重存储
+// @Param retention 	处理完成后记录的保留时间
+func NewDedup(store DedupStore, retention time.Duration) *Dedup {
+	return &Dedup{Store: store, Lease: 5 * time.Minute, Retention: retention}
+}
+
+// @Title 包装 Handler：已处理过的消息直接返回nil(随后被删除)，正在处理中的返回 ErrDuplicateInFlight
+// @Param queuename 队列名称，用于区分不同队列的键
+// @Param next 		原 Handler
+func (this *Dedup) Wrap(queuename string, next Handler) Handler {
+	return func(msg *ReceivedMessage) error {
+		key := queuename + ":" + DedupKey(msg)
+		state, err := this.Store.Claim(key, this.Lease)
+		if err != nil {
+			return err
+		}
+		switch state {
+		case DedupDone:
+			return nil
+		case DedupProcessing:
+			return ErrDuplicateInFlight
+		}
+		if err := next(msg); err != nil {
+			if rerr := this.Store.Release(key); rerr != nil {
+				return rerr
+			}
+			return err
+		}
+		return this.Store.Commit(key, this.Retention)
+	}
+}
+
+// @Title 消息的去重键，优先使用信封中的幂等键
+func DedupKey(msg *ReceivedMessage) string {
+	if key := msg.Header(HeaderIdempotencyKey); key != "" {
+		return key
+	}
+	return msg.OriginMessageId()
+}
+
+// 内存LRU去重存储，超过容量时淘汰最久未使用的键，只适用于单进程
+type MemoryDedupStore struct {
+	Capacity int
+
+	lock  sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+type dedupItem struct {
+	key    string
+	state  DedupState
+	expire time.Time
+}
+
+// @Title 创建内存LRU去重存储
+// @Param capacity 最多保存的键数
+func NewMemoryDedupStore(capacity int) *MemoryDedupStore {
+	return &MemoryDedupStore{Capacity: capacity, order: list.New(), items: map[string]*list.Element{}}
+}
+
+func (this *MemoryDedupStore) Claim(key string, lease time.Duration) (DedupState, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if e, ok := this.items[key]; ok {
+		item := e.Value.(*dedupItem)
+		if item.expire.After(time.Now()) {
+			this.order.MoveToFront(e)
+			return item.state, nil
+		}
+	}
+	this.set(key, DedupProcessing, lease)
+	return DedupNew, nil
+}
+
+func (this *MemoryDedupStore) Commit(key string, retention time.Duration) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.set(key, DedupDone, retention)
+	return nil
+}
+
+func (this *MemoryDedupStore) Release(key string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if e, ok := this.items[key]; ok {
+		this.order.Remove(e)
+		delete(this.items, key)
+	}
+	return nil
+}
+
+func (this *MemoryDedupStore) set(key string, state DedupState, ttl time.Duration) {
+	item := &dedupItem{key: key, state: state, expire: time.Now().Add(ttl)}
+	if e, ok := this.items[key]; ok {
+		e.Value = item
+		this.order.MoveToFront(e)
+		return
+	}
+	this.items[key] = this.order.PushFront(item)
+	for this.Capacity > 0 && this.order.Len() > this.Capacity {
+		e := this.order.Back()
+		this.order.Remove(e)
+		delete(this.items, e.Value.(*dedupItem).key)
+	}
+}
+
+// SQLite去重存储
+type SQLiteDedupStore struct {
+	db    *sql.DB
+	table string
+}
+
+// @Title 创建SQLite去重存储，表不存在时自动创建
+// @Param db 	已打开的SQLite数据库
+// @Param table 表名
+func NewSQLiteDedupStore(db *sql.DB, table string) (*SQLiteDedupStore, error) {
+	_, err := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (dedup_key TEXT PRIMARY KEY, state INTEGER NOT NULL, expire_at INTEGER NOT NULL)", table))
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteDedupStore{db: db, table: table}, nil
+}
+
+func (this *SQLiteDedupStore) Claim(key string, lease time.Duration) (DedupState, error) {
+	now := time.Now()
+	if _, err := this.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE expire_at <= ?", this.table), now.UnixNano()); err != nil {
+		return DedupNew, err
+	}
+	result, err := this.db.Exec(fmt.Sprintf("INSERT OR IGNORE INTO %s (dedup_key, state, expire_at) VALUES (?, ?, ?)", this.table), key, DedupProcessing, now.Add(lease).UnixNano())
+	if err != nil {
+		return DedupNew, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 1 {
+		return DedupNew, err
+	}
+	var state DedupState
+	err = this.db.QueryRow(fmt.Sprintf("SELECT state FROM %s WHERE dedup_key = ?", this.table), key).Scan(&state)
+	return state, err
+}
+
+func (this *SQLiteDedupStore) Commit(key string, retention time.Duration) error {
+	_, err := this.db.Exec(fmt.Sprintf("INSERT OR REPLACE INTO %s (dedup_key, state, expire_at) VALUES (?, ?, ?)", this.table), key, DedupDone, time.Now().Add(retention).UnixNano())
+	return err
+}
+
+func (this *SQLiteDedupStore) Release(key string) error {
+	_, err := this.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE dedup_key = ?", this.table), key)
+	return err
+}
@@ -0,0 +1,205 @@
+package aliyunMQS
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// 只支持 SET/GET/DEL 的Redis桩服务
+func newMockRedis() net.Listener {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	var lock sync.Mutex
+	values := map[string]string{}
+	expire := map[string]time.Time{}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					reply, err := readRESP(r)
+					if err != nil {
+						return
+					}
+					args := []string{}
+					for _, arg := range reply.([]interface{}) {
+						args = append(args, arg.(string))
+					}
+					lock.Lock()
+					key := args[1]
+					if t, ok := expire[key]; ok && !t.After(time.Now()) {
+						delete(values, key)
+					}
+					switch strings.ToUpper(args[0]) {
+					case "SET":
+						_, exists := values[key]
+						nx := false
+						var ttl time.Duration
+						for i := 3; i < len(args); i++ {
+							switch strings.ToUpper(args[i]) {
+							case "NX":
+								nx = true
+							case "PX":
+								ms, _ := strconv.Atoi(args[i+1])
+								ttl = time.Duration(ms) * time.Millisecond
+								i++
+							}
+						}
+						if nx && exists {
+							fmt.Fprint(conn, "$-1\r\n")
+						} else {
+							values[key] = args[2]
+							expire[key] = time.Now().Add(ttl)
+							fmt.Fprint(conn, "+OK\r\n")
+						}
+					case "GET":
+						if v, ok := values[key]; ok {
+							fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(v), v)
+						} else {
+							fmt.Fprint(conn, "$-1\r\n")
+						}
+					case "DEL":
+						delete(values, key)
+						fmt.Fprint(conn, ":1\r\n")
+					default:
+						fmt.Fprint(conn, "-ERR unknown command\r\n")
+					}
+					lock.Unlock()
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func TestDedupStore(t *testing.T) {
+	Convey("去重存储测试", t, func() {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "dedup.db"))
+		So(err, ShouldBeNil)
+		defer db.Close()
+		sqlite, err := NewSQLiteDedupStore(db, "dedup")
+		So(err, ShouldBeNil)
+		redis := newMockRedis()
+		defer redis.Close()
+		redisStore := NewRedisDedupStore(redis.Addr().String())
+		defer redisStore.Close()
+
+		stores := map[string]DedupStore{"内存": NewMemoryDedupStore(100), "SQLite": sqlite, "Redis": redisStore}
+		for name, store := range stores {
+			Convey(name, func() {
+				state, err := store.Claim("k1", time.Minute)
+				So(err, ShouldBeNil)
+				So(state, ShouldEqual, DedupNew)
+				state, _ = store.Claim("k1", time.Minute)
+				So(state, ShouldEqual, DedupProcessing)
+
+				So(store.Commit("k1", time.Hour), ShouldBeNil)
+				state, _ = store.Claim("k1", time.Minute)
+				So(state, ShouldEqual, DedupDone)
+
+				store.Claim("k2", time.Minute)
+				So(store.Release("k2"), ShouldBeNil)
+				state, _ = store.Claim("k2", time.Minute)
+				So(state, ShouldEqual, DedupNew)
+
+				store.Claim("k3", time.Millisecond)
+				time.Sleep(5 * time.Millisecond)
+				state, _ = store.Claim("k3", time.Minute)
+				So(state, ShouldEqual, DedupNew)
+			})
+		}
+
+		Convey("LRU淘汰最久未使用的键", func() {
+			store := NewMemoryDedupStore(2)
+			store.Commit("a", time.Hour)
+			store.Commit("b", time.Hour)
+			store.Claim("a", time.Minute)
+			store.Commit("c", time.Hour)
+			state, _ := store.Claim("a", time.Minute)
+			So(state, ShouldEqual, DedupDone)
+			state, _ = store.Claim("b", time.Minute)
+			So(state, ShouldEqual, DedupNew)
+		})
+	})
+}
+
+func TestDedup(t *testing.T) {
+	Convey("幂等消费测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		queue.CreateQueue("payments", nil)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+
+		charged := 0
+		fail := false
+		dedup := NewDedup(NewMemoryDedupStore(100), time.Hour)
+		consumer := NewConsumer(&msg, "payments", dedup.Wrap("payments", func(m *ReceivedMessage) error {
+			if fail {
+				return errors.New("fail")
+			}
+			charged++
+			return nil
+		}))
+
+		Convey("重复投递的消息只处理一次", func() {
+			msg.SendMessage("payments", "pay-1", nil)
+			m, _ := msg.Receive("payments", 0)
+			So(consumer.Handler(m), ShouldBeNil)
+			// 删除前超时重新投递
+			mock.expire("payments")
+			again, _ := msg.Receive("payments", 0)
+			So(consumer.Process(again), ShouldBeNil)
+			So(charged, ShouldEqual, 1)
+			So(mock.count("payments"), ShouldEqual, 0)
+		})
+
+		Convey("按信封幂等键去重", func() {
+			for i := 0; i < 2; i++ {
+				env := NewEnvelope("pay")
+				env.Set(HeaderIdempotencyKey, "order-9")
+				msg.SendEnvelope("payments", env, nil)
+				m, _ := msg.Receive("payments", 0)
+				So(consumer.Process(m), ShouldBeNil)
+			}
+			So(charged, ShouldEqual, 1)
+		})
+
+		Convey("处理失败后可以重新处理", func() {
+			msg.SendMessage("payments", "pay-2", nil)
+			fail = true
+			m, _ := msg.Receive("payments", 0)
+			So(consumer.Process(m), ShouldNotBeNil)
+			fail = false
+			mock.expire("payments")
+			m, _ = msg.Receive("payments", 0)
+			So(consumer.Process(m), ShouldBeNil)
+			So(charged, ShouldEqual, 1)
+		})
+
+		Convey("处理中的重复消息不删除", func() {
+			msg.SendMessage("payments", "pay-3", nil)
+			m, _ := msg.Receive("payments", 0)
+			dedup.Store.Claim("payments:"+DedupKey(m), time.Minute)
+			So(consumer.Process(m), ShouldEqual, ErrDuplicateInFlight)
+			So(mock.count("payments"), ShouldEqual, 1)
+		})
+	})
+}
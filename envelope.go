@@ -0,0 +1,93 @@
+package aliyunMQS
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// 信封中使用的头信息名称
+const (
+	HeaderEncKeyId     = "x-enc-key-id"
+	HeaderEncDataKey   = "x-enc-data-key"
+	HeaderEncAlgorithm = "x-enc-algorithm"
+
+	// 消息被重新投递时记录最初的 MessageId
+	HeaderOriginMessageId = "x-origin-message-id"
+)
+
+// 消息信封，包装在 MessageBody 中，用于携带正文以外的头信息
+type Envelope struct {
+	XMLName xml.Name         `xml:"Envelope"`
+	Version string           `xml:"Version,attr"`
+	Headers []EnvelopeHeader `xml:"Header"`
+	Body    string           `xml:"Body"`
+}
+
+// 信封头
+type EnvelopeHeader struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:"Value,attr"`
+}
+
+// @Title 创建一个新的信封
+// @Param body 消息正文
+func NewEnvelope(body string) *Envelope {
+	return &Envelope{Version: "1", Body: body}
+}
+
+// @Title 解析消息正文中的信封，正文不是信封时返回false
+// @Param body 消息正文
+func DecodeEnvelope(body string) (*Envelope, bool) {
+	if !strings.HasPrefix(strings.TrimSpace(body), "<Envelope") {
+		return nil, false
+	}
+	env := &Envelope{}
+	if err := xml.Unmarshal([]byte(body), env); err != nil {
+		return nil, false
+	}
+	return env, true
+}
+
+// @Title 获取头信息，不存在时返回空字符串
+func (this *Envelope) Get(name string) string {
+	for _, h := range this.Headers {
+		if h.Name == name {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// @Title 设置头信息，已存在时覆盖
+func (this *Envelope) Set(name, value string) {
+	for i, h := range this.Headers {
+		if h.Name == name {
+			this.Headers[i].Value = value
+			return
+		}
+	}
+	this.Headers = append(this.Headers, EnvelopeHeader{Name: name, Value: value})
+}
+
+// @Title 删除头信息
+func (this *Envelope) Del(name string) {
+	headers := this.Headers[:0]
+	for _, h := range this.Headers {
+		if h.Name != name {
+			headers = append(headers, h)
+		}
+	}
+	this.Headers = headers
+}
+
+// @Title 编码为可放入 MessageBody 的字符串
+func (this *Envelope) Encode() (string, error) {
+	if this.Version == "" {
+		this.Version = "1"
+	}
+	output, err := xml.Marshal(this)
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
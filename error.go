@@ -0,0 +1,63 @@
+package aliyunMQS
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+)
+
+// MQS 返回的错误
+type MQSError struct {
+	StatusCode int    `xml:"-"`
+	Content    string `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	RequestId  string `xml:"RequestId"`
+	HostId     string `xml:"HostId"`
+}
+
+func newMQSError(statuscode int, content string) *MQSError {
+	e := &MQSError{StatusCode: statuscode, Content: content}
+	xml.Unmarshal([]byte(content), e)
+	return e
+}
+
+func (this *MQSError) Error() string {
+	return fmt.Sprintf("Code:%d,Content:%s", this.StatusCode, this.Content)
+}
+
+// @Title 判断是否为队列中没有消息的错误
+func IsMessageNotExist(err error) bool {
+	var e *MQSError
+	return errors.As(err, &e) && e.Code == "MessageNotExist"
+}
+
+// @Title 判断是否为可以重试的错误：网络错误或服务端5xx错误。参数错误、封装消息失败等其他错误不可重试
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var e *MQSError
+	if errors.As(err, &e) {
+		return e.StatusCode >= 500
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
+
+// @Title 判断是否为队列已存在的错误
+func IsQueueAlreadyExist(err error) bool {
+	var e *MQSError
+	return errors.As(err, &e) && e.Code == "QueueAlreadyExist"
+}
+
+// @Title 判断是否为队列不存在的错误
+func IsQueueNotExist(err error) bool {
+	var e *MQSError
+	return errors.As(err, &e) && e.Code == "QueueNotExist"
+}
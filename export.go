@@ -0,0 +1,193 @@
+package aliyunMQS
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// 导出方式
+type ExportMode int
+
+const (
+	// 接收消息，写入后从队列删除
+	ExportDrain ExportMode = iota
+	// 不删除消息。PeekMessage 只能查看队首的一条消息，所以只导出一条(Limit为1)时使用
+	// PeekMessage，没有副作用；其他情况通过接收实现，结束时恢复可见：
+	// 导出期间消息对消费者不可见，每条消息的 DequeueCount 加1，
+	// 多次快照可能使未处理的消息达到死信策略的 MaxDeliveries
+	ExportSnapshot
+)
+
+// 导出的一条消息，JSON Lines 格式的一行
+type ExportedMessage struct {
+	MessageId        string `json:"MessageId"`
+	MessageBodyMD5   string `json:"MessageBodyMD5,omitempty"`
+	EnqueueTime      int64  `json:"EnqueueTime,omitempty"`
+	FirstDequeueTime int64  `json:"FirstDequeueTime,omitempty"`
+	DequeueCount     int    `json:"DequeueCount,omitempty"`
+	Priority         int    `json:"Priority,omitempty"`
+	// 信封中的头信息，只用于查看，导入时以 MessageBody 为准
+	Headers map[string]string `json:"Headers,omitempty"`
+	// 队列中的原始正文，信封、加密、签名原样保留
+	MessageBody string `json:"MessageBody"`
+}
+
+// 导出参数
+type ExportOptions struct {
+	Mode ExportMode
+	// 最多导出的消息数，0表示直到队列为空
+	Limit int
+	// 队列消费者使用的死信策略。设置后 ExportSnapshot 会增加 DequeueCount，除只导出一条外不允许快照
+	DeadLetter *DeadLetterPolicy
+}
+
+// @Title 把队列中的消息以 JSON Lines 格式写入w
+// @Param queuename 队列名称
+// @Param w 		输出
+// @Param opts 		参数
+func (this *Message) Export(ctx context.Context, queuename string, w io.Writer, opts ExportOptions) (int, error) {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	if opts.Mode == ExportSnapshot && opts.Limit == 1 {
+		return this.exportPeek(queuename, encoder)
+	}
+	if opts.Mode == ExportSnapshot && opts.DeadLetter != nil {
+		return 0, errors.New("快照会增加消息的 DequeueCount，队列有死信策略时可能把未处理的消息转入死信队列")
+	}
+	// 快照时记录已导出的消息，超过 VisibilityTimeout 重新收到时结束
+	seen := map[string]bool{}
+	released := []string{}
+	defer func() {
+		for _, handle := range released {
+			this.ChangeMessageVisibility(queuename, handle, 1)
+		}
+	}()
+
+	n := 0
+	for opts.Limit <= 0 || n < opts.Limit {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		// 不解密、不校验签名，原样导出
+		content, err := this.receiveMessage(queuename, 0)
+		if err != nil {
+			if IsMessageNotExist(err) {
+				return n, nil
+			}
+			return n, err
+		}
+		msg, err := ParseReceivedMessage(content)
+		if err != nil {
+			return n, err
+		}
+		if opts.Mode == ExportSnapshot {
+			released = append(released, msg.ReceiptHandle)
+			if seen[msg.MessageId] {
+				return n, nil
+			}
+			seen[msg.MessageId] = true
+		}
+		if err := encoder.Encode(newExportedMessage(msg)); err != nil {
+			if opts.Mode == ExportDrain {
+				released = append(released, msg.ReceiptHandle)
+			}
+			return n, err
+		}
+		n++
+		if opts.Mode == ExportDrain {
+			if _, err := this.DeleteMessage(queuename, msg.ReceiptHandle); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// 用 PeekMessage 导出队首的一条消息
+func (this *Message) exportPeek(queuename string, encoder *json.Encoder) (int, error) {
+	content, err := this.peekMessage(queuename)
+	if err != nil {
+		if IsMessageNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	msg, err := ParseReceivedMessage(content)
+	if err != nil {
+		return 0, err
+	}
+	if err := encoder.Encode(newExportedMessage(msg)); err != nil {
+		return 0, err
+	}
+	return 1, nil
+}
+
+func newExportedMessage(msg *ReceivedMessage) *ExportedMessage {
+	record := &ExportedMessage{
+		MessageId:        msg.MessageId,
+		MessageBodyMD5:   msg.MessageBodyMD5,
+		EnqueueTime:      msg.EnqueueTime,
+		FirstDequeueTime: msg.FirstDequeueTime,
+		DequeueCount:     msg.DequeueCount,
+		Priority:         msg.Priority,
+		MessageBody:      msg.MessageBody,
+	}
+	if env, ok := DecodeEnvelope(msg.MessageBody); ok && len(env.Headers) > 0 {
+		record.Headers = map[string]string{}
+		for _, h := range env.Headers {
+			record.Headers[h.Name] = h.Value
+		}
+	}
+	return record
+}
+
+// 导入参数
+type ImportOptions struct {
+	// 每秒最多发送的消息数，0表示不限
+	Rate float64
+}
+
+// @Title 把 Export 导出的 JSON Lines 按顺序发送到队列，保留优先级，正文原样发送
+// @Param queuename 队列名称
+// @Param r 		输入
+// @Param opts 		参数
+func (this *Message) Import(ctx context.Context, queuename string, r io.Reader, opts ImportOptions) (int, error) {
+	var interval time.Duration
+	if opts.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / opts.Rate)
+	}
+	scanner := bufio.NewScanner(r)
+	// 正文最大64KB，转义后可能更长
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	n, line := 0, 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		record := &ExportedMessage{}
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return n, fmt.Errorf("第%d行: %w", line, err)
+		}
+		param := map[string]int{}
+		if record.Priority > 0 {
+			param["Priority"] = record.Priority
+		}
+		if _, err := this.sendMessage(queuename, record.MessageBody, param); err != nil {
+			return n, fmt.Errorf("第%d行: %w", line, err)
+		}
+		n++
+		if interval > 0 && !sleep(ctx, interval) {
+			return n, ctx.Err()
+		}
+	}
+	return n, scanner.Err()
+}
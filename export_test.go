@@ -0,0 +1,99 @@
+package aliyunMQS
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExport(t *testing.T) {
+	Convey("导出导入测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		var message Message
+		mock.NewMQS(&queue.MQS)
+		mock.NewMQS(&message.MQS)
+		queue.CreateQueue("src", nil)
+		queue.CreateQueue("dst", nil)
+		for i := 0; i < 5; i++ {
+			message.SendMessage("src", fmt.Sprintf("m%d", i), map[string]int{"Priority": i + 1})
+		}
+		env := NewEnvelope("<with envelope>")
+		env.Set("x-trace-id", "t1")
+		message.SendEnvelope("src", env, nil)
+
+		Convey("快照不删除消息", func() {
+			var out bytes.Buffer
+			n, err := message.Export(context.Background(), "src", &out, ExportOptions{Mode: ExportSnapshot})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 6)
+			So(strings.Count(out.String(), "\n"), ShouldEqual, 6)
+			So(out.String(), ShouldContainSubstring, `"Headers":{"x-trace-id":"t1"}`)
+			So(mock.count("src"), ShouldEqual, 6)
+			mock.expire("src")
+			m, err := message.Peek("src")
+			So(err, ShouldBeNil)
+			So(m.MessageBody, ShouldEqual, "m0")
+		})
+
+		Convey("只导出一条时使用 PeekMessage", func() {
+			var out bytes.Buffer
+			n, err := message.Export(context.Background(), "src", &out, ExportOptions{Mode: ExportSnapshot, Limit: 1})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(out.String(), ShouldContainSubstring, `"MessageBody":"m0"`)
+			m, err := message.Receive("src", 0)
+			So(err, ShouldBeNil)
+			So(m.MessageBody, ShouldEqual, "m0")
+			So(m.DequeueCount, ShouldEqual, 1)
+		})
+
+		Convey("有死信策略时拒绝快照", func() {
+			var out bytes.Buffer
+			_, err := message.Export(context.Background(), "src", &out, ExportOptions{Mode: ExportSnapshot, DeadLetter: &DeadLetterPolicy{Queue: "dlq", MaxDeliveries: 3}})
+			So(err, ShouldNotBeNil)
+			So(out.Len(), ShouldEqual, 0)
+			m, err := message.Peek("src")
+			So(err, ShouldBeNil)
+			So(m.DequeueCount, ShouldEqual, 0)
+		})
+
+		Convey("导出并清空后导入到另一个队列", func() {
+			var out bytes.Buffer
+			n, err := message.Export(context.Background(), "src", &out, ExportOptions{Mode: ExportDrain, Limit: 4})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 4)
+			So(mock.count("src"), ShouldEqual, 2)
+			_, err = message.Export(context.Background(), "src", &out, ExportOptions{})
+			So(err, ShouldBeNil)
+			So(mock.count("src"), ShouldEqual, 0)
+
+			n, err = message.Import(context.Background(), "dst", &out, ImportOptions{Rate: 1000})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 6)
+			So(mock.count("dst"), ShouldEqual, 6)
+			m, err := message.Receive("dst", 0)
+			So(err, ShouldBeNil)
+			So(m.MessageBody, ShouldEqual, "m0")
+			So(m.Priority, ShouldEqual, 1)
+			for i := 0; i < 5; i++ {
+				m, err = message.Receive("dst", 0)
+				So(err, ShouldBeNil)
+			}
+			So(m.MessageBody, ShouldEqual, "<with envelope>")
+			So(m.Header("x-trace-id"), ShouldEqual, "t1")
+		})
+
+		Convey("格式错误的行", func() {
+			_, err := message.Import(context.Background(), "dst", strings.NewReader("{\"MessageBody\":\"a\"}\n\nnot json\n"), ImportOptions{})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "第3行")
+			So(mock.count("dst"), ShouldEqual, 1)
+		})
+	})
+}
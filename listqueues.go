@@ -0,0 +1,62 @@
+package aliyunMQS
+
+import (
+	"iter"
+	"strconv"
+)
+
+// ListQueues 的参数
+type ListOptions struct {
+	// 只列出以此前缀开头的队列
+	Prefix string
+	// 每页的队列数，1-1000，0表示使用服务端默认值1000
+	PageSize int
+}
+
+// @Title 列出所有队列，自动按 NextMarker 翻页。请求出错时产生一次错误后结束
+// @Param opts 参数
+func (this *Queue) ListQueues(opts ListOptions) iter.Seq2[*QueueInfo, error] {
+	return func(yield func(*QueueInfo, error) bool) {
+		number := ""
+		if opts.PageSize > 0 {
+			number = strconv.Itoa(opts.PageSize)
+		}
+		marker := ""
+		for {
+			content, err := this.ListQueue(opts.Prefix, marker, number)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			list, err := ParseQueueList(content)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			for _, q := range list.Queues {
+				if !yield(q, nil) {
+					return
+				}
+			}
+			if list.NextMarker == "" {
+				return
+			}
+			marker = list.NextMarker
+		}
+	}
+}
+
+// @Title 列出所有队列，对每个队列调用fn，fn返回错误时停止并返回该错误
+// @Param opts 	参数
+// @Param fn 	回调函数
+func (this *Queue) ListQueuesEach(opts ListOptions, fn func(q *QueueInfo) error) error {
+	for q, err := range this.ListQueues(opts) {
+		if err != nil {
+			return err
+		}
+		if err := fn(q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
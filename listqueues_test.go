@@ -0,0 +1,63 @@
+package aliyunMQS
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestListQueues(t *testing.T) {
+	Convey("队列列表测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		for i := 0; i < 5; i++ {
+			queue.CreateQueue(fmt.Sprintf("app-%d", i), nil)
+		}
+		queue.CreateQueue("other", nil)
+
+		Convey("按NextMarker翻页", func() {
+			names := []string{}
+			for q, err := range queue.ListQueues(ListOptions{Prefix: "app-", PageSize: 2}) {
+				So(err, ShouldBeNil)
+				So(q.URL, ShouldEndWith, "/"+q.Name)
+				names = append(names, q.Name)
+			}
+			So(names, ShouldResemble, []string{"app-0", "app-1", "app-2", "app-3", "app-4"})
+		})
+
+		Convey("提前结束迭代", func() {
+			n := 0
+			for range queue.ListQueues(ListOptions{PageSize: 1}) {
+				n++
+				if n == 2 {
+					break
+				}
+			}
+			So(n, ShouldEqual, 2)
+		})
+
+		Convey("回调形式", func() {
+			names := []string{}
+			err := queue.ListQueuesEach(ListOptions{}, func(q *QueueInfo) error {
+				names = append(names, q.Name)
+				return nil
+			})
+			So(err, ShouldBeNil)
+			So(len(names), ShouldEqual, 6)
+
+			stop := errors.New("stop")
+			err = queue.ListQueuesEach(ListOptions{}, func(q *QueueInfo) error { return stop })
+			So(err, ShouldEqual, stop)
+		})
+
+		Convey("请求出错时返回错误", func() {
+			mock.setDown(true)
+			err := queue.ListQueuesEach(ListOptions{}, func(q *QueueInfo) error { return nil })
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
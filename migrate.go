@@ -0,0 +1,147 @@
+package aliyunMQS
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 迁移消息的参数
+type MigrateOptions struct {
+	// 并发迁移的协程数
+	Concurrency int
+	// 最多迁移的消息数，0表示直到源队列为空
+	Limit int
+	// 定期报告进度，结束时再报告一次
+	Progress func(progress MigrateResult)
+	// 报告进度的间隔
+	ProgressInterval time.Duration
+}
+
+// 迁移结果
+type MigrateResult struct {
+	// 从源队列接收的消息数
+	Received int
+	// 发送到目标队列并从源队列删除的消息数
+	Migrated int
+	// 发送或删除失败的消息数
+	Failed int
+}
+
+// 迁移过程中的计数
+type migrateCounter struct {
+	received, migrated, failed atomic.Int64
+}
+
+func (this *migrateCounter) result() MigrateResult {
+	return MigrateResult{Received: int(this.received.Load()), Migrated: int(this.migrated.Load()), Failed: int(this.failed.Load())}
+}
+
+// @Title 把源队列中的消息迁移到目标队列，源和目标可以在不同的账号或地域。
+// 消息正文(包括信封头信息，以及加密、签名)原样发送，保留优先级，发送成功后才从源队列删除。
+// 发送或删除失败时停止迁移并返回错误，未删除的消息在 VisibilityTimeout 后重新可见
+// @Param from 		源队列的客户端
+// @Param source 		源队列名称
+// @Param to 			目标队列的客户端
+// @Param destination 	目标队列名称
+// @Param opts 			参数
+func Migrate(ctx context.Context, from *Message, source string, to *Message, destination string, opts MigrateOptions) (*MigrateResult, error) {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	interval := opts.ProgressInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	counter := &migrateCounter{}
+	var claimed atomic.Int64
+	var once sync.Once
+	var failure error
+	fail := func(err error) {
+		once.Do(func() { failure = err })
+		cancel()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				if opts.Limit > 0 && claimed.Add(1) > int64(opts.Limit) {
+					return
+				}
+				done, err := migrateOne(from, source, to, destination, counter)
+				if err != nil {
+					fail(err)
+					return
+				}
+				if done {
+					return
+				}
+			}
+		}()
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopped:
+			result := counter.result()
+			if opts.Progress != nil {
+				opts.Progress(result)
+			}
+			if failure != nil {
+				return &result, failure
+			}
+			// 外部取消时返回取消原因
+			return &result, context.Cause(ctx)
+		case <-ticker.C:
+			if opts.Progress != nil {
+				opts.Progress(counter.result())
+			}
+		}
+	}
+}
+
+// 迁移一条消息，源队列为空时返回true
+func migrateOne(from *Message, source string, to *Message, destination string, counter *migrateCounter) (bool, error) {
+	// 不解密、不校验签名，原样转发
+	content, err := from.receiveMessage(source, 0)
+	if err != nil {
+		if IsMessageNotExist(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	msg, err := ParseReceivedMessage(content)
+	if err != nil {
+		return false, err
+	}
+	counter.received.Add(1)
+	param := map[string]int{}
+	if msg.Priority > 0 {
+		param["Priority"] = msg.Priority
+	}
+	if _, err := to.sendMessage(destination, msg.MessageBody, param); err != nil {
+		counter.failed.Add(1)
+		return false, err
+	}
+	if _, err := from.DeleteMessage(source, msg.ReceiptHandle); err != nil {
+		counter.failed.Add(1)
+		return false, err
+	}
+	counter.migrated.Add(1)
+	return false, nil
+}
@@ -0,0 +1,76 @@
+package aliyunMQS
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMigrate(t *testing.T) {
+	Convey("消息迁移测试", t, func() {
+		source := newMockMQS()
+		defer source.Close()
+		target := newMockMQS()
+		defer target.Close()
+		var srcQueue, dstQueue Queue
+		var from, to Message
+		source.NewMQS(&srcQueue.MQS)
+		source.NewMQS(&from.MQS)
+		target.NewMQS(&dstQueue.MQS)
+		target.NewMQS(&to.MQS)
+		srcQueue.CreateQueue("old", nil)
+		dstQueue.CreateQueue("new", nil)
+
+		signer := NewSigner("k1", "secret")
+		signed := from
+		signed.Signer = signer
+		for i := 0; i < 20; i++ {
+			_, err := signed.SendMessage("old", fmt.Sprintf("m%d", i), map[string]int{"Priority": i%16 + 1})
+			So(err, ShouldBeNil)
+		}
+
+		Convey("并发迁移并保留优先级和信封", func() {
+			var lock sync.Mutex
+			reports := []MigrateResult{}
+			result, err := Migrate(context.Background(), &from, "old", &to, "new", MigrateOptions{
+				Concurrency: 4,
+				Progress: func(p MigrateResult) {
+					lock.Lock()
+					reports = append(reports, p)
+					lock.Unlock()
+				},
+			})
+			So(err, ShouldBeNil)
+			So(result.Migrated, ShouldEqual, 20)
+			So(source.count("old"), ShouldEqual, 0)
+			So(target.count("new"), ShouldEqual, 20)
+			So(reports[len(reports)-1], ShouldResemble, *result)
+
+			// 签名在目标队列仍可校验
+			receiver := to
+			receiver.Signer = signer
+			msg, err := receiver.Receive("new", 0)
+			So(err, ShouldBeNil)
+			So(msg.Priority, ShouldEqual, 1)
+			So(msg.Header(HeaderSignSignature), ShouldNotBeEmpty)
+		})
+
+		Convey("限制数量", func() {
+			result, err := Migrate(context.Background(), &from, "old", &to, "new", MigrateOptions{Concurrency: 3, Limit: 7})
+			So(err, ShouldBeNil)
+			So(result.Migrated, ShouldEqual, 7)
+			So(source.count("old"), ShouldEqual, 13)
+		})
+
+		Convey("发送失败时不删除", func() {
+			target.setDown(true)
+			result, err := Migrate(context.Background(), &from, "old", &to, "new", MigrateOptions{Concurrency: 2})
+			So(err, ShouldNotBeNil)
+			So(result.Migrated, ShouldEqual, 0)
+			So(source.count("old"), ShouldEqual, 20)
+		})
+	})
+}
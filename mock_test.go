@@ -0,0 +1,329 @@
+package aliyunMQS
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 内存中的MQS服务，用于测试
+type mockMQS struct {
+	server *httptest.Server
+	lock   sync.Mutex
+	queues map[string]*mockQueue
+	seq    int
+	// 为true时所有请求返回503
+	down bool
+	// 为true时 GetQueueAttributes 把所有消息计为可见，模拟统计延迟
+	lagging bool
+	// 收到的请求数
+	requests int
+}
+
+type mockQueue struct {
+	attrs    map[string]int
+	created  int64
+	messages []*mockMessage
+}
+
+type mockMessage struct {
+	id           string
+	handle       string
+	body         string
+	priority     int
+	enqueue      time.Time
+	visible      time.Time
+	firstDequeue time.Time
+	dequeueCount int
+}
+
+func newMockMQS() *mockMQS {
+	mock := &mockMQS{queues: map[string]*mockQueue{}}
+	mock.server = httptest.NewServer(http.HandlerFunc(mock.serveHTTP))
+	return mock
+}
+
+func (this *mockMQS) Close() {
+	this.server.Close()
+}
+
+// 服务地址为 http://127.0.0.1:port，拆分成 QueueOwnId 和 MqsUrl
+func (this *mockMQS) NewMQS(mqs *MQS) {
+	host := strings.TrimPrefix(this.server.URL, "http://")
+	i := strings.Index(host, ".")
+	mqs.NewMQS("key", "secret", host[:i], host[i+1:])
+}
+
+func (this *mockMQS) nextId() string {
+	this.seq++
+	return fmt.Sprintf("%08d", this.seq)
+}
+
+func (this *mockMQS) writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error xmlns="http://mqs.aliyuncs.com/doc/v1/"><Code>%s</Code><Message>%s</Message><RequestId>0</RequestId><HostId>mock</HostId></Error>`, code, code)
+}
+
+func (this *mockMQS) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	this.requests++
+	if this.down {
+		this.writeError(w, 503, "ServiceUnavailable")
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/" && r.Method == "GET":
+		this.listQueue(w, r)
+	case len(parts) == 1:
+		this.queue(w, r, parts[0], body)
+	case len(parts) == 2 && parts[1] == "messages":
+		q, ok := this.queues[parts[0]]
+		if !ok {
+			this.writeError(w, 404, "QueueNotExist")
+			return
+		}
+		this.message(w, r, q, body)
+	default:
+		this.writeError(w, 400, "InvalidArgument")
+	}
+}
+
+func (this *mockMQS) queue(w http.ResponseWriter, r *http.Request, name string, body []byte) {
+	q, ok := this.queues[name]
+	switch r.Method {
+	case "PUT":
+		attrs := struct {
+			DelaySeconds           *int
+			MaximumMessageSize     *int
+			MessageRetentionPeriod *int
+			VisibilityTimeout      *int
+			PollingWaitSeconds     *int
+		}{}
+		if err := xml.Unmarshal(body, &attrs); err != nil {
+			this.writeError(w, 400, "InvalidArgument")
+			return
+		}
+		if r.URL.Query().Get("metaoverride") == "true" {
+			if !ok {
+				this.writeError(w, 404, "QueueNotExist")
+				return
+			}
+		} else {
+			if ok {
+				this.writeError(w, 409, "QueueAlreadyExist")
+				return
+			}
+			q = &mockQueue{created: time.Now().Unix(), attrs: map[string]int{"DelaySeconds": 0, "MaximumMessageSize": 65536, "MessageRetentionPeriod": 345600, "VisibilityTimeout": 30, "PollingWaitSeconds": 0}}
+			this.queues[name] = q
+		}
+		set := func(k string, v *int) {
+			if v != nil {
+				q.attrs[k] = *v
+			}
+		}
+		set("DelaySeconds", attrs.DelaySeconds)
+		set("MaximumMessageSize", attrs.MaximumMessageSize)
+		set("MessageRetentionPeriod", attrs.MessageRetentionPeriod)
+		set("VisibilityTimeout", attrs.VisibilityTimeout)
+		set("PollingWaitSeconds", attrs.PollingWaitSeconds)
+		if ok {
+			w.WriteHeader(204)
+		} else {
+			w.WriteHeader(201)
+		}
+	case "GET":
+		if !ok {
+			this.writeError(w, 404, "QueueNotExist")
+			return
+		}
+		now := time.Now()
+		active, inactive, delay := 0, 0, 0
+		for _, m := range q.messages {
+			switch {
+			case this.lagging:
+				active++
+			case m.dequeueCount == 0 && m.visible.After(now):
+				delay++
+			case m.visible.After(now):
+				inactive++
+			default:
+				active++
+			}
+		}
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Queue xmlns="http://mqs.aliyuncs.com/doc/v1/"><QueueName>%s</QueueName><CreateTime>%d</CreateTime><LastModifyTime>%d</LastModifyTime><DelaySeconds>%d</DelaySeconds><MaximumMessageSize>%d</MaximumMessageSize><MessageRetentionPeriod>%d</MessageRetentionPeriod><VisibilityTimeout>%d</VisibilityTimeout><PollingWaitSeconds>%d</PollingWaitSeconds><ActiveMessages>%d</ActiveMessages><InactiveMessages>%d</InactiveMessages><DelayMessages>%d</DelayMessages></Queue>`,
+			name, q.created, q.created, q.attrs["DelaySeconds"], q.attrs["MaximumMessageSize"], q.attrs["MessageRetentionPeriod"], q.attrs["VisibilityTimeout"], q.attrs["PollingWaitSeconds"], active, inactive, delay)
+	case "DELETE":
+		delete(this.queues, name)
+		w.WriteHeader(204)
+	default:
+		this.writeError(w, 400, "InvalidArgument")
+	}
+}
+
+func (this *mockMQS) listQueue(w http.ResponseWriter, r *http.Request) {
+	prefix := r.Header.Get("x-mqs-prefix")
+	marker := r.Header.Get("x-mqs-marker")
+	number, err := strconv.Atoi(r.Header.Get("x-mqs-ret-number"))
+	if err != nil || number <= 0 {
+		number = 1000
+	}
+	names := []string{}
+	for name := range this.queues {
+		if strings.HasPrefix(name, prefix) && name >= marker {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	next := ""
+	if len(names) > number {
+		next = names[number]
+		names = names[:number]
+	}
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?><Queues xmlns="http://mqs.aliyuncs.com/doc/v1/">`)
+	for _, name := range names {
+		fmt.Fprintf(w, "<Queue><QueueURL>http://%s/%s</QueueURL></Queue>", r.Host, name)
+	}
+	if next != "" {
+		fmt.Fprintf(w, "<NextMarker>%s</NextMarker>", next)
+	}
+	fmt.Fprint(w, "</Queues>")
+}
+
+func (this *mockMQS) message(w http.ResponseWriter, r *http.Request, q *mockQueue, body []byte) {
+	query := r.URL.Query()
+	now := time.Now()
+	switch r.Method {
+	case "POST":
+		param := struct {
+			MessageBody  string
+			DelaySeconds *int
+			Priority     *int
+		}{}
+		if err := xml.Unmarshal(body, &param); err != nil {
+			this.writeError(w, 400, "InvalidArgument")
+			return
+		}
+		m := &mockMessage{id: this.nextId(), body: param.MessageBody, priority: 8, enqueue: now, visible: now}
+		if param.Priority != nil {
+			m.priority = *param.Priority
+		}
+		delay := q.attrs["DelaySeconds"]
+		if param.DelaySeconds != nil {
+			delay = *param.DelaySeconds
+		}
+		m.visible = now.Add(time.Duration(delay) * time.Second)
+		q.messages = append(q.messages, m)
+		sum := md5.Sum([]byte(m.body))
+		w.WriteHeader(201)
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Message xmlns="http://mqs.aliyuncs.com/doc/v1/"><MessageId>%s</MessageId><MessageBodyMD5>%s</MessageBodyMD5></Message>`, m.id, strings.ToUpper(hex.EncodeToString(sum[:])))
+	case "GET":
+		var found *mockMessage
+		for _, m := range q.messages {
+			if !m.visible.After(now) && (found == nil || m.priority < found.priority) {
+				found = m
+			}
+		}
+		if found == nil {
+			this.writeError(w, 404, "MessageNotExist")
+			return
+		}
+		if query.Get("peekonly") != "true" {
+			found.dequeueCount++
+			if found.firstDequeue.IsZero() {
+				found.firstDequeue = now
+			}
+			found.handle = this.nextId() + "-" + found.id
+			found.visible = now.Add(time.Duration(q.attrs["VisibilityTimeout"]) * time.Second)
+		}
+		this.writeMessage(w, found, query.Get("peekonly") != "true")
+	case "DELETE":
+		handle := query.Get("ReceiptHandle")
+		for i, m := range q.messages {
+			if m.handle != "" && m.handle == handle {
+				q.messages = append(q.messages[:i], q.messages[i+1:]...)
+				w.WriteHeader(204)
+				return
+			}
+		}
+		this.writeError(w, 404, "MessageNotExist")
+	case "PUT":
+		handle := query.Get("ReceiptHandle")
+		timeout, _ := strconv.Atoi(query.Get("VisibilityTimeout"))
+		for _, m := range q.messages {
+			if m.handle != "" && m.handle == handle {
+				m.handle = this.nextId() + "-" + m.id
+				m.visible = now.Add(time.Duration(timeout) * time.Second)
+				fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><ChangeVisibility xmlns="http://mqs.aliyuncs.com/doc/v1/"><ReceiptHandle>%s</ReceiptHandle><NextVisibleTime>%d</NextVisibleTime></ChangeVisibility>`, m.handle, m.visible.UnixNano()/1e6)
+				return
+			}
+		}
+		this.writeError(w, 404, "MessageNotExist")
+	default:
+		this.writeError(w, 400, "InvalidArgument")
+	}
+}
+
+func (this *mockMQS) writeMessage(w http.ResponseWriter, m *mockMessage, withHandle bool) {
+	sum := md5.Sum([]byte(m.body))
+	var out strings.Builder
+	out.WriteString(`<?xml version="1.0" encoding="UTF-8"?><Message xmlns="http://mqs.aliyuncs.com/doc/v1/">`)
+	fmt.Fprintf(&out, "<MessageId>%s</MessageId>", m.id)
+	if withHandle {
+		fmt.Fprintf(&out, "<ReceiptHandle>%s</ReceiptHandle>", m.handle)
+	}
+	fmt.Fprintf(&out, "<MessageBodyMD5>%s</MessageBodyMD5>", strings.ToUpper(hex.EncodeToString(sum[:])))
+	out.WriteString("<MessageBody>")
+	xml.EscapeText(&out, []byte(m.body))
+	out.WriteString("</MessageBody>")
+	fmt.Fprintf(&out, "<EnqueueTime>%d</EnqueueTime><NextVisibleTime>%d</NextVisibleTime>", m.enqueue.UnixNano()/1e6, m.visible.UnixNano()/1e6)
+	if !m.firstDequeue.IsZero() {
+		fmt.Fprintf(&out, "<FirstDequeueTime>%d</FirstDequeueTime>", m.firstDequeue.UnixNano()/1e6)
+	}
+	fmt.Fprintf(&out, "<DequeueCount>%d</DequeueCount><Priority>%d</Priority></Message>", m.dequeueCount, m.priority)
+	fmt.Fprint(w, out.String())
+}
+
+// 队列中的消息数
+func (this *mockMQS) count(queuename string) int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if q, ok := this.queues[queuename]; ok {
+		return len(q.messages)
+	}
+	return 0
+}
+
+// 使队列中所有消息立即可见
+func (this *mockMQS) expire(queuename string) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if q, ok := this.queues[queuename]; ok {
+		for _, m := range q.messages {
+			m.visible = time.Now()
+		}
+	}
+}
+
+func (this *mockMQS) requestCount() int {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.requests
+}
+
+func (this *mockMQS) setDown(down bool) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.down = down
+}
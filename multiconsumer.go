@@ -0,0 +1,201 @@
+package aliyunMQS
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+// 多队列消费的调度方式
+type Schedule int
+
+const (
+	// 按权重平滑轮询，权重越大被轮询得越频繁
+	ScheduleWeighted Schedule = iota
+	// 按添加顺序严格优先，高优先级队列有消息时不处理低优先级队列，
+	// 低优先级队列连续 MaxStarvation 次未被轮询时优先轮询一次
+	ScheduleStrict
+)
+
+// 多队列消费者，按调度方式从多个队列接收消息，交给共享的工作协程池处理
+type MultiConsumer struct {
+	Schedule Schedule
+	// 共享的工作协程数
+	Workers int
+	// 所有队列都没有消息时长轮询的等待时间,单位为秒。为0时等待第一个队列的 ErrorBackoff 后再轮询
+	WaitSeconds int
+	// 严格优先时低优先级队列最多连续被跳过的次数，0表示不限
+	MaxStarvation int
+
+	sources []*multiSource
+}
+
+type multiSource struct {
+	consumer *Consumer
+	weight   int
+	current  int
+	skipped  int
+}
+
+// @Title 创建多队列消费者
+// @Param workers 共享的工作协程数
+func NewMultiConsumer(workers int) *MultiConsumer {
+	return &MultiConsumer{Workers: workers, WaitSeconds: 10, MaxStarvation: 10}
+}
+
+// @Title 添加一个队列。ScheduleStrict 时先添加的队列优先级高
+// @Param c 		队列的消费者，其 Handler、死信、退避等配置照常生效
+// @Param weight 	权重，ScheduleWeighted 时有效
+func (this *MultiConsumer) Add(c *Consumer, weight int) {
+	if weight < 1 {
+		weight = 1
+	}
+	this.sources = append(this.sources, &multiSource{consumer: c, weight: weight})
+}
+
+// @Title 持续消费所有队列，直到ctx被取消
+func (this *MultiConsumer) Run(ctx context.Context) error {
+	if len(this.sources) == 0 {
+		return nil
+	}
+	workers := this.Workers
+	if workers < 1 {
+		workers = 1
+	}
+	// 有空闲的工作协程时才接收消息，避免消息在本地等待期间超过 VisibilityTimeout
+	idle := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case idle <- struct{}{}:
+		}
+		source, msg := this.receive(ctx)
+		if msg == nil {
+			<-idle
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-idle }()
+			c := source.consumer
+			if err := c.Process(msg); err != nil {
+				log.Printf("队列%s消息%s处理失败: %v", c.QueueName, msg.MessageId, err)
+			}
+		}()
+	}
+}
+
+// 按调度顺序依次短轮询，都没有消息时在第一个队列上长轮询
+func (this *MultiConsumer) receive(ctx context.Context) (*multiSource, *ReceivedMessage) {
+	order := this.order()
+	for _, source := range order {
+		if ctx.Err() != nil {
+			return nil, nil
+		}
+		if msg := this.poll(ctx, source, 0); msg != nil {
+			this.served(source)
+			return source, msg
+		}
+		source.skipped = 0
+	}
+	if ctx.Err() != nil {
+		return nil, nil
+	}
+	if this.WaitSeconds <= 0 {
+		// 所有队列刚刚短轮询过，等待一段时间再轮询，避免连续请求空队列
+		sleep(ctx, emptyPollWait(0, order[0].consumer.ErrorBackoff))
+		return nil, nil
+	}
+	if msg := this.poll(ctx, order[0], this.WaitSeconds); msg != nil {
+		this.served(order[0])
+		return order[0], msg
+	}
+	return nil, nil
+}
+
+func (this *MultiConsumer) poll(ctx context.Context, source *multiSource, waitseconds int) *ReceivedMessage {
+	c := source.consumer
+	msg, err := c.Message.Receive(c.QueueName, waitseconds)
+	if err != nil {
+		var oerr *OpenError
+		if errors.As(err, &oerr) {
+			log.Printf("%v", err)
+			if rerr := c.rejectUnopened(oerr); rerr != nil {
+				log.Printf("队列%s消息%s处理失败: %v", c.QueueName, oerr.Message.MessageId, rerr)
+			}
+			return nil
+		}
+		if !IsMessageNotExist(err) {
+			log.Printf("队列%s接收消息失败: %v", c.QueueName, err)
+			sleep(ctx, c.ErrorBackoff)
+		}
+		return nil
+	}
+	return msg
+}
+
+// 记录其他队列被跳过的次数
+func (this *MultiConsumer) served(source *multiSource) {
+	for _, s := range this.sources {
+		if s == source {
+			s.skipped = 0
+		} else {
+			s.skipped++
+		}
+	}
+}
+
+// 本次轮询的队列顺序
+func (this *MultiConsumer) order() []*multiSource {
+	order := make([]*multiSource, 0, len(this.sources))
+	if this.Schedule == ScheduleStrict {
+		// 饥饿的队列排在最前
+		for _, s := range this.sources {
+			if this.MaxStarvation > 0 && s.skipped >= this.MaxStarvation {
+				order = append(order, s)
+			}
+		}
+		for _, s := range this.sources {
+			if this.MaxStarvation <= 0 || s.skipped < this.MaxStarvation {
+				order = append(order, s)
+			}
+		}
+		return order
+	}
+	// 平滑加权轮询选出第一个队列，其余按权重从大到小
+	total := 0
+	var first *multiSource
+	for _, s := range this.sources {
+		s.current += s.weight
+		total += s.weight
+		if first == nil || s.current > first.current {
+			first = s
+		}
+	}
+	first.current -= total
+	order = append(order, first)
+	for len(order) < len(this.sources) {
+		var next *multiSource
+		for _, s := range this.sources {
+			if !containsSource(order, s) && (next == nil || s.weight > next.weight) {
+				next = s
+			}
+		}
+		order = append(order, next)
+	}
+	return order
+}
+
+func containsSource(sources []*multiSource, source *multiSource) bool {
+	for _, s := range sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package aliyunMQS
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMultiConsumer(t *testing.T) {
+	Convey("多队列消费测试", t, func() {
+		Convey("平滑加权轮询", func() {
+			multi := NewMultiConsumer(1)
+			multi.Add(&Consumer{QueueName: "high"}, 3)
+			multi.Add(&Consumer{QueueName: "low"}, 1)
+			counts := map[string]int{}
+			for i := 0; i < 8; i++ {
+				counts[multi.order()[0].consumer.QueueName]++
+			}
+			So(counts, ShouldResemble, map[string]int{"high": 6, "low": 2})
+		})
+
+		Convey("严格优先时防止饥饿", func() {
+			multi := NewMultiConsumer(1)
+			multi.Schedule = ScheduleStrict
+			multi.MaxStarvation = 2
+			multi.Add(&Consumer{QueueName: "high"}, 1)
+			multi.Add(&Consumer{QueueName: "low"}, 1)
+			So(multi.order()[0].consumer.QueueName, ShouldEqual, "high")
+			multi.served(multi.sources[0])
+			multi.served(multi.sources[0])
+			So(multi.order()[0].consumer.QueueName, ShouldEqual, "low")
+		})
+
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+		for _, name := range []string{"high", "normal", "low"} {
+			queue.CreateQueue(name, nil)
+			for i := 0; i < 4; i++ {
+				msg.SendMessage(name, name, nil)
+			}
+		}
+
+		Convey("共享工作协程处理所有队列", func() {
+			var lock sync.Mutex
+			got := []string{}
+			running, peak := 0, 0
+			ctx, cancel := context.WithCancel(context.Background())
+			handler := func(m *ReceivedMessage) error {
+				lock.Lock()
+				running++
+				if running > peak {
+					peak = running
+				}
+				lock.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				lock.Lock()
+				defer lock.Unlock()
+				running--
+				got = append(got, m.MessageBody)
+				if len(got) == 12 {
+					cancel()
+				}
+				return nil
+			}
+			multi := NewMultiConsumer(2)
+			multi.Schedule = ScheduleStrict
+			multi.WaitSeconds = 0
+			for _, name := range []string{"high", "normal", "low"} {
+				multi.Add(NewConsumer(&msg, name, handler), 1)
+			}
+			So(multi.Run(ctx), ShouldEqual, context.Canceled)
+			So(len(got), ShouldEqual, 12)
+			So(peak, ShouldBeLessThanOrEqualTo, 2)
+			So(got[0], ShouldEqual, "high")
+		})
+
+		Convey("短轮询所有队列为空时等待后再轮询", func() {
+			queue.CreateQueue("idle1", nil)
+			queue.CreateQueue("idle2", nil)
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			multi := NewMultiConsumer(1)
+			multi.WaitSeconds = 0
+			for _, name := range []string{"idle1", "idle2"} {
+				consumer := NewConsumer(&msg, name, func(m *ReceivedMessage) error { return nil })
+				consumer.ErrorBackoff = 50 * time.Millisecond
+				multi.Add(consumer, 1)
+			}
+			start := mock.requestCount()
+			So(multi.Run(ctx), ShouldEqual, context.DeadlineExceeded)
+			So(mock.requestCount()-start, ShouldBeLessThanOrEqualTo, 10)
+		})
+	})
+}
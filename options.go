@@ -0,0 +1,161 @@
+package aliyunMQS
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// 参数校验失败，可用 errors.Is 判断
+var ErrInvalidParam = errors.New("参数错误")
+
+// 参数的取值范围,单位为秒
+const (
+	maxDelaySeconds      = 345600
+	minVisibilityTimeout = 1
+	maxVisibilityTimeout = 43200
+)
+
+// 参数的取值范围
+type paramRange struct {
+	min, max int
+	unit     string
+}
+
+// CreateQueue/SetQueueAttributes 的参数
+var queueParams = map[string]paramRange{
+	"DelaySeconds":           {0, maxDelaySeconds, "秒"},
+	"MaximumMessageSize":     {1024, 65536, "字节"},
+	"MessageRetentionPeriod": {60, 604800, "秒"},
+	"VisibilityTimeout":      {minVisibilityTimeout, maxVisibilityTimeout, "秒"},
+	"PollingWaitSeconds":     {0, 30, "秒"},
+}
+
+// SendMessage 的参数
+var messageParams = map[string]paramRange{
+	"DelaySeconds": {0, maxDelaySeconds, "秒"},
+	"Priority":     {1, 16, ""},
+}
+
+// @Title 校验参数名称和取值范围
+// @Param param 	参数
+// @Param ranges 	允许的参数及其范围
+func validateParam(param map[string]int, ranges map[string]paramRange) error {
+	for k, v := range param {
+		r, ok := ranges[k]
+		if !ok {
+			return fmt.Errorf("%w: 未知参数 %s", ErrInvalidParam, k)
+		}
+		if v < r.min || v > r.max {
+			return fmt.Errorf("%w: %s 为 %d%s，取值范围为 %d~%d%s", ErrInvalidParam, k, v, r.unit, r.min, r.max, r.unit)
+		}
+	}
+	return nil
+}
+
+// 队列或消息的参数，通过 WithDelay 等函数生成
+type Option func(param map[string]int) error
+
+// @Title 把参数转换成 CreateQueue/SendMessage 使用的map，并校验取值范围
+// @Param ranges 	允许的参数及其范围
+// @Param opts 		参数
+func buildParam(ranges map[string]paramRange, opts []Option) (map[string]int, error) {
+	param := map[string]int{}
+	for _, opt := range opts {
+		if err := opt(param); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateParam(param, ranges); err != nil {
+		return nil, err
+	}
+	return param, nil
+}
+
+func durationOption(name string, d time.Duration) Option {
+	return func(param map[string]int) error {
+		if d < 0 {
+			return fmt.Errorf("%w: %s 不能为负数 %v", ErrInvalidParam, name, d)
+		}
+		param[name] = int(math.Ceil(d.Seconds()))
+		return nil
+	}
+}
+
+func intOption(name string, v int) Option {
+	return func(param map[string]int) error {
+		param[name] = v
+		return nil
+	}
+}
+
+// @Title 延迟时间，按秒向上取整，范围 0~4天。用于队列和消息
+func WithDelay(d time.Duration) Option {
+	return durationOption("DelaySeconds", d)
+}
+
+// @Title 消息被接收后的不可见时间，按秒向上取整，范围 1秒~12小时。用于队列
+func WithVisibilityTimeout(d time.Duration) Option {
+	return durationOption("VisibilityTimeout", d)
+}
+
+// @Title 消息的最长保留时间，按秒向上取整，范围 60秒~7天。用于队列
+func WithRetention(d time.Duration) Option {
+	return durationOption("MessageRetentionPeriod", d)
+}
+
+// @Title 长轮询等待时间，按秒向上取整，范围 0~30秒。用于队列
+func WithPollingWait(d time.Duration) Option {
+	return durationOption("PollingWaitSeconds", d)
+}
+
+// @Title 消息正文的最大长度，范围 1024~65536字节。用于队列
+func WithMaxMessageSize(bytes int) Option {
+	return intOption("MaximumMessageSize", bytes)
+}
+
+// @Title 消息的优先级，范围 1~16，1为最高优先级。用于消息
+func WithPriority(priority int) Option {
+	return intOption("Priority", priority)
+}
+
+// @Title 创建队列，参数在发送请求前校验
+// @Param queuename 队列名称
+// @Param opts 		参数，可用 WithDelay、WithVisibilityTimeout、WithRetention、WithPollingWait、WithMaxMessageSize
+func (this *Queue) Create(queuename string, opts ...Option) error {
+	param, err := buildParam(queueParams, opts)
+	if err != nil {
+		return err
+	}
+	_, err = this.CreateQueue(queuename, param)
+	return err
+}
+
+// @Title 修改队列属性，只修改给出的属性，参数在发送请求前校验
+// @Param queuename 队列名称
+// @Param opts 		参数，同 Create
+func (this *Queue) Update(queuename string, opts ...Option) error {
+	param, err := buildParam(queueParams, opts)
+	if err != nil {
+		return err
+	}
+	_, err = this.SetQueueAttributes(queuename, param)
+	return err
+}
+
+// @Title 发送消息，参数在发送请求前校验
+// @Param queuename 	队列名称
+// @Param messagebody 	消息正文
+// @Param opts 			参数，可用 WithDelay、WithPriority
+func (this *Message) Send(queuename, messagebody string, opts ...Option) (*SendResult, error) {
+	param, err := buildParam(messageParams, opts)
+	if err != nil {
+		return nil, err
+	}
+	content, err := this.SendMessage(queuename, messagebody, param)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSendResult(content)
+}
@@ -0,0 +1,70 @@
+package aliyunMQS
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOptions(t *testing.T) {
+	Convey("参数校验测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		var message Message
+		mock.NewMQS(&queue.MQS)
+		mock.NewMQS(&message.MQS)
+
+		Convey("类型化参数创建队列和发送消息", func() {
+			err := queue.Create("typed", WithVisibilityTimeout(90*time.Second), WithPollingWait(1500*time.Millisecond), WithRetention(time.Hour))
+			So(err, ShouldBeNil)
+			attrs, err := queue.Attributes("typed")
+			So(err, ShouldBeNil)
+			So(attrs.VisibilityTimeout, ShouldEqual, 90)
+			So(attrs.PollingWaitSeconds, ShouldEqual, 2)
+			So(attrs.MessageRetentionPeriod, ShouldEqual, 3600)
+
+			So(queue.Update("typed", WithDelay(time.Second)), ShouldBeNil)
+			attrs, _ = queue.Attributes("typed")
+			So(attrs.DelaySeconds, ShouldEqual, 1)
+			So(attrs.VisibilityTimeout, ShouldEqual, 90)
+
+			result, err := message.Send("typed", "hello", WithPriority(1), WithDelay(0))
+			So(err, ShouldBeNil)
+			So(result.MessageId, ShouldNotBeEmpty)
+		})
+
+		Convey("超出范围的参数不发送请求", func() {
+			err := queue.Create("bad", WithPollingWait(time.Minute))
+			So(errors.Is(err, ErrInvalidParam), ShouldBeTrue)
+			So(err.Error(), ShouldContainSubstring, "PollingWaitSeconds")
+			So(err.Error(), ShouldContainSubstring, "0~30")
+			So(mock.queues, ShouldNotContainKey, "bad")
+
+			So(errors.Is(queue.Create("bad", WithMaxMessageSize(100)), ErrInvalidParam), ShouldBeTrue)
+			So(errors.Is(queue.Create("bad", WithDelay(-time.Second)), ErrInvalidParam), ShouldBeTrue)
+
+			queue.CreateQueue("msgs", nil)
+			_, err = message.Send("msgs", "hello", WithPriority(17))
+			So(errors.Is(err, ErrInvalidParam), ShouldBeTrue)
+			So(mock.count("msgs"), ShouldEqual, 0)
+		})
+
+		Convey("队列参数不能用于消息", func() {
+			queue.CreateQueue("msgs", nil)
+			_, err := message.Send("msgs", "hello", WithVisibilityTimeout(time.Minute))
+			So(errors.Is(err, ErrInvalidParam), ShouldBeTrue)
+			So(queue.Create("bad", WithPriority(1)), ShouldNotBeNil)
+		})
+
+		Convey("map参数中拼错的名称返回错误", func() {
+			_, err := queue.CreateQueue("bad", map[string]int{"VisibilityTimeOut": 60})
+			So(errors.Is(err, ErrInvalidParam), ShouldBeTrue)
+			queue.CreateQueue("msgs", nil)
+			_, err = message.SendMessage("msgs", "hello", map[string]int{"Priorty": 1})
+			So(errors.Is(err, ErrInvalidParam), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,237 @@
+// outbox 实现事务性发件箱：消息在业务事务中写入发件箱表，由 Relay 读取后调用 SendMessage 投递，
+// 保证业务数据和消息同时提交或同时回滚。
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/congjunwei/aliyunMQS"
+)
+
+// 发件箱表
+type Outbox struct {
+	db    *sql.DB
+	table string
+}
+
+// 发件箱中待发送的消息
+type Entry struct {
+	Id           int64
+	QueueName    string
+	MessageBody  string
+	DelaySeconds int
+	Priority     int
+	Attempts     int
+}
+
+// @Title 创建发件箱
+// @Param db 	数据库
+// @Param table 发件箱表名
+func New(db *sql.DB, table string) *Outbox {
+	return &Outbox{db: db, table: table}
+}
+
+// @Title 创建发件箱表(SQLite语法)，表已存在时不做处理
+func (this *Outbox) CreateTable() error {
+	_, err := this.db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	queue_name TEXT NOT NULL,
+	message_body TEXT NOT NULL,
+	delay_seconds INTEGER NOT NULL DEFAULT 0,
+	priority INTEGER NOT NULL DEFAULT 8,
+	created_at INTEGER NOT NULL,
+	sent_at INTEGER,
+	message_id TEXT,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	last_error TEXT
+)`, this.table))
+	return err
+}
+
+// @Title 在调用方的事务中写入一条消息，事务提交后由 Relay 发送
+// @Param tx 			业务事务
+// @Param queuename 	队列名称
+// @Param messagebody 	消息正文
+// @Param param 		参数，支持 DelaySeconds 和 Priority
+func (this *Outbox) Enqueue(tx *sql.Tx, queuename, messagebody string, param map[string]int) (int64, error) {
+	//默认参数
+	_param := map[string]int{"DelaySeconds": 0, "Priority": 8}
+	for k := range _param {
+		if v, ok := param[k]; ok {
+			_param[k] = v
+		}
+	}
+	result, err := tx.Exec(fmt.Sprintf("INSERT INTO %s (queue_name, message_body, delay_seconds, priority, created_at) VALUES (?, ?, ?, ?, ?)", this.table),
+		queuename, messagebody, _param["DelaySeconds"], _param["Priority"], time.Now().UnixNano()/1e6)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// @Title 按写入顺序读取待发送的消息
+// @Param limit 最多读取的条数
+func (this *Outbox) Pending(limit int) ([]*Entry, error) {
+	return this.query("sent_at IS NULL", limit)
+}
+
+// @Title 按写入顺序读取尝试次数低于 maxattempts 的待发送消息
+// @Param maxattempts 	最多尝试次数
+// @Param limit 		最多读取的条数
+func (this *Outbox) PendingBelow(maxattempts, limit int) ([]*Entry, error) {
+	return this.query("sent_at IS NULL AND attempts < "+strconv.Itoa(maxattempts), limit)
+}
+
+// @Title 读取尝试次数达到 maxattempts 后被搁置的消息
+// @Param maxattempts 	最多尝试次数
+// @Param limit 		最多读取的条数
+func (this *Outbox) Parked(maxattempts, limit int) ([]*Entry, error) {
+	return this.query("sent_at IS NULL AND attempts >= "+strconv.Itoa(maxattempts), limit)
+}
+
+// @Title 清零尝试次数，使被搁置的消息重新发送
+func (this *Outbox) Retry(id int64) error {
+	_, err := this.db.Exec(fmt.Sprintf("UPDATE %s SET attempts = 0 WHERE id = ? AND sent_at IS NULL", this.table), id)
+	return err
+}
+
+func (this *Outbox) query(where string, limit int) ([]*Entry, error) {
+	rows, err := this.db.Query(fmt.Sprintf("SELECT id, queue_name, message_body, delay_seconds, priority, attempts FROM %s WHERE %s ORDER BY id LIMIT ?", this.table, where), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := []*Entry{}
+	for rows.Next() {
+		e := &Entry{}
+		if err := rows.Scan(&e.Id, &e.QueueName, &e.MessageBody, &e.DelaySeconds, &e.Priority, &e.Attempts); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// @Title 标记消息已发送
+func (this *Outbox) MarkSent(id int64, messageid string) error {
+	_, err := this.db.Exec(fmt.Sprintf("UPDATE %s SET sent_at = ?, message_id = ?, attempts = attempts + 1 WHERE id = ?", this.table), time.Now().UnixNano()/1e6, messageid, id)
+	return err
+}
+
+// @Title 记录发送失败
+func (this *Outbox) MarkFailed(id int64, reason string) error {
+	_, err := this.db.Exec(fmt.Sprintf("UPDATE %s SET attempts = attempts + 1, last_error = ? WHERE id = ?", this.table), reason, id)
+	return err
+}
+
+// @Title 记录可重试的发送失败，不计入尝试次数
+func (this *Outbox) MarkRetrying(id int64, reason string) error {
+	_, err := this.db.Exec(fmt.Sprintf("UPDATE %s SET last_error = ? WHERE id = ?", this.table), reason, id)
+	return err
+}
+
+// @Title 删除 before 之前已发送的消息
+func (this *Outbox) Cleanup(before time.Time) (int64, error) {
+	result, err := this.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE sent_at IS NOT NULL AND sent_at < ?", this.table), before.UnixNano()/1e6)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// 发件箱中继，按写入顺序发送消息，遇到失败时停止本轮以保持顺序。
+// 同一个发件箱只能运行一个 Relay
+type Relay struct {
+	Outbox  *Outbox
+	Message *aliyunMQS.Message
+	// 每轮最多发送的消息数
+	BatchSize int
+	// 没有待发送消息或发送失败后等待的时间
+	Interval time.Duration
+	// 每条消息遇到不可重试的错误(如队列不存在、参数错误)时最多尝试的次数，达到后搁置，
+	// 不再阻塞后面的消息。网络错误和服务端5xx错误不计入次数。0表示不限
+	MaxAttempts int
+	// 以信封形式发送并带上幂等键 "表名:id"，中继在发送后、标记前中断会重复发送，
+	// 消费端可按幂等键去重。为false时正文原样发送(配置了 Encryptor/Signer 时除外)
+	IdempotencyKey bool
+}
+
+// @Title 创建发件箱中继
+// @Param outbox 	发件箱
+// @Param msg 		消息客户端
+func NewRelay(outbox *Outbox, msg *aliyunMQS.Message) *Relay {
+	return &Relay{Outbox: outbox, Message: msg, BatchSize: 100, Interval: time.Second, MaxAttempts: 10}
+}
+
+// @Title 持续发送发件箱中的消息，直到ctx被取消
+func (this *Relay) Run(ctx context.Context) error {
+	for {
+		n, err := this.Flush()
+		if err != nil {
+			log.Printf("发件箱%s发送失败: %v", this.Outbox.table, err)
+		}
+		if n < this.BatchSize || err != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(this.Interval):
+			}
+		} else if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// @Title 发送一批待发送的消息，返回成功发送的条数。尝试次数达到 MaxAttempts 的消息被搁置，见 Outbox.Parked
+func (this *Relay) Flush() (int, error) {
+	var entries []*Entry
+	var err error
+	if this.MaxAttempts > 0 {
+		entries, err = this.Outbox.PendingBelow(this.MaxAttempts, this.BatchSize)
+	} else {
+		entries, err = this.Outbox.Pending(this.BatchSize)
+	}
+	if err != nil {
+		return 0, err
+	}
+	for i, e := range entries {
+		param := map[string]int{"DelaySeconds": e.DelaySeconds, "Priority": e.Priority}
+		var content string
+		if this.IdempotencyKey {
+			env := aliyunMQS.NewEnvelope(e.MessageBody)
+			env.Set(aliyunMQS.HeaderIdempotencyKey, this.Outbox.table+":"+strconv.FormatInt(e.Id, 10))
+			content, err = this.Message.SendEnvelope(e.QueueName, env, param)
+		} else {
+			content, err = this.Message.SendMessage(e.QueueName, e.MessageBody, param)
+		}
+		if err != nil {
+			if aliyunMQS.IsRetryable(err) {
+				// 服务不可用时保持顺序等待恢复，不搁置
+				if merr := this.Outbox.MarkRetrying(e.Id, err.Error()); merr != nil {
+					return i, merr
+				}
+				return i, err
+			}
+			if merr := this.Outbox.MarkFailed(e.Id, err.Error()); merr != nil {
+				return i, merr
+			}
+			if this.MaxAttempts > 0 && e.Attempts+1 >= this.MaxAttempts {
+				log.Printf("发件箱%s的消息%d尝试%d次后搁置: %v", this.Outbox.table, e.Id, e.Attempts+1, err)
+			}
+			return i, err
+		}
+		messageid := ""
+		if result, err := aliyunMQS.ParseSendResult(content); err == nil {
+			messageid = result.MessageId
+		}
+		if err := this.Outbox.MarkSent(e.Id, messageid); err != nil {
+			return i, err
+		}
+	}
+	return len(entries), nil
+}
@@ -0,0 +1,189 @@
+package outbox
+
+import (
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/congjunwei/aliyunMQS"
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// 记录 SendMessage 请求的MQS桩服务
+type mockMQS struct {
+	*httptest.Server
+	lock   sync.Mutex
+	bodies []string
+	keys   []string
+	fail   bool
+}
+
+func newMockMQS() *mockMQS {
+	mock := &mockMQS{}
+	mock.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mock.lock.Lock()
+		defer mock.lock.Unlock()
+		if mock.fail {
+			w.WriteHeader(500)
+			fmt.Fprint(w, "<Error><Code>InternalError</Code></Error>")
+			return
+		}
+		content, _ := ioutil.ReadAll(r.Body)
+		param := struct{ MessageBody string }{}
+		xml.Unmarshal(content, &param)
+		if strings.Contains(r.URL.Path, "missing") {
+			w.WriteHeader(404)
+			fmt.Fprint(w, "<Error><Code>QueueNotExist</Code></Error>")
+			return
+		}
+		if env, ok := aliyunMQS.DecodeEnvelope(param.MessageBody); ok {
+			mock.bodies = append(mock.bodies, env.Body)
+			mock.keys = append(mock.keys, env.Get(aliyunMQS.HeaderIdempotencyKey))
+		} else {
+			mock.bodies = append(mock.bodies, param.MessageBody)
+			mock.keys = append(mock.keys, "")
+		}
+		w.WriteHeader(201)
+		fmt.Fprintf(w, "<Message><MessageId>m%d</MessageId><MessageBodyMD5></MessageBodyMD5></Message>", len(mock.bodies))
+	}))
+	return mock
+}
+
+func (this *mockMQS) message() *aliyunMQS.Message {
+	host := strings.TrimPrefix(this.URL, "http://")
+	i := strings.Index(host, ".")
+	msg := &aliyunMQS.Message{}
+	msg.NewMQS("key", "secret", host[:i], host[i+1:])
+	return msg
+}
+
+func TestOutbox(t *testing.T) {
+	Convey("事务性发件箱测试", t, func() {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "app.db"))
+		So(err, ShouldBeNil)
+		defer db.Close()
+		db.SetMaxOpenConns(1)
+		_, err = db.Exec("CREATE TABLE orders (id INTEGER PRIMARY KEY, amount INTEGER)")
+		So(err, ShouldBeNil)
+
+		box := New(db, "outbox")
+		So(box.CreateTable(), ShouldBeNil)
+		mock := newMockMQS()
+		defer mock.Close()
+		relay := NewRelay(box, mock.message())
+
+		placeOrder := func(id int, commit bool) {
+			tx, err := db.Begin()
+			So(err, ShouldBeNil)
+			_, err = tx.Exec("INSERT INTO orders (id, amount) VALUES (?, ?)", id, 100)
+			So(err, ShouldBeNil)
+			_, err = box.Enqueue(tx, "orders", fmt.Sprintf("order-%d", id), nil)
+			So(err, ShouldBeNil)
+			if commit {
+				So(tx.Commit(), ShouldBeNil)
+			} else {
+				So(tx.Rollback(), ShouldBeNil)
+			}
+		}
+
+		Convey("只发送已提交事务中的消息，并保持顺序", func() {
+			placeOrder(1, true)
+			placeOrder(2, false)
+			placeOrder(3, true)
+			n, err := relay.Flush()
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So(mock.bodies, ShouldResemble, []string{"order-1", "order-3"})
+			// 默认正文原样发送
+			So(mock.keys, ShouldResemble, []string{"", ""})
+
+			pending, err := box.Pending(10)
+			So(err, ShouldBeNil)
+			So(pending, ShouldBeEmpty)
+		})
+
+		Convey("启用幂等键时以信封发送", func() {
+			relay.IdempotencyKey = true
+			placeOrder(1, true)
+			_, err := relay.Flush()
+			So(err, ShouldBeNil)
+			So(mock.bodies, ShouldResemble, []string{"order-1"})
+			So(mock.keys, ShouldResemble, []string{"outbox:1"})
+		})
+
+		Convey("超过最多尝试次数的消息被搁置", func() {
+			relay.MaxAttempts = 2
+			tx, _ := db.Begin()
+			box.Enqueue(tx, "missing", "lost", nil)
+			tx.Commit()
+			placeOrder(2, true)
+			for i := 0; i < 2; i++ {
+				n, err := relay.Flush()
+				So(err, ShouldNotBeNil)
+				So(n, ShouldEqual, 0)
+			}
+			n, err := relay.Flush()
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(mock.bodies, ShouldResemble, []string{"order-2"})
+
+			parked, err := box.Parked(2, 10)
+			So(err, ShouldBeNil)
+			So(len(parked), ShouldEqual, 1)
+			So(parked[0].QueueName, ShouldEqual, "missing")
+			So(box.Retry(parked[0].Id), ShouldBeNil)
+			parked, _ = box.Parked(2, 10)
+			So(parked, ShouldBeEmpty)
+		})
+
+		Convey("发送失败时保留消息并在恢复后按顺序发送", func() {
+			placeOrder(1, true)
+			placeOrder(2, true)
+			mock.fail = true
+			n, err := relay.Flush()
+			So(err, ShouldNotBeNil)
+			So(n, ShouldEqual, 0)
+
+			mock.fail = false
+			n, err = relay.Flush()
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So(mock.bodies, ShouldResemble, []string{"order-1", "order-2"})
+
+			var attempts int
+			var messageid string
+			db.QueryRow("SELECT attempts, message_id FROM outbox WHERE id = 1").Scan(&attempts, &messageid)
+			So(attempts, ShouldEqual, 1)
+			So(messageid, ShouldEqual, "m1")
+		})
+
+		Convey("服务长时间不可用时不搁置消息", func() {
+			relay.MaxAttempts = 2
+			placeOrder(1, true)
+			placeOrder(2, true)
+			mock.fail = true
+			for i := 0; i < 5; i++ {
+				n, err := relay.Flush()
+				So(aliyunMQS.IsRetryable(err), ShouldBeTrue)
+				So(n, ShouldEqual, 0)
+			}
+			parked, err := box.Parked(2, 10)
+			So(err, ShouldBeNil)
+			So(parked, ShouldBeEmpty)
+
+			mock.fail = false
+			n, err := relay.Flush()
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 2)
+			So(mock.bodies, ShouldResemble, []string{"order-1", "order-2"})
+		})
+	})
+}
@@ -0,0 +1,217 @@
+package aliyunMQS
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strconv"
+	"time"
+)
+
+// 分区队列信封中使用的头信息名称
+const (
+	HeaderOrderingKey = "x-ordering-key"
+	HeaderPartitions  = "x-partitions"
+)
+
+// 原地重试时，消息在退避时间之外额外保持不可见的时间，留给下一次处理
+const partitionRetryTimeout = 30 * time.Second
+
+// 分区队列，按顺序键把消息散列到N个物理队列，每个物理队列由一个消费者串行处理，
+// 从而保证同一个键的消息按发送顺序处理
+type PartitionedQueue struct {
+	Queue   *Queue
+	Message *Message
+	// 逻辑队列名称，物理队列为 Name-p0 ~ Name-p(N-1)
+	Name       string
+	Partitions int
+	// 处理失败时在原地重试的次数，重试期间不处理同一分区的后续消息。
+	// 超过次数后转发到 DeadLetterQueue 再处理后续消息；DeadLetterQueue 为空时一直原地重试
+	MaxRetries int
+	Backoff    *Backoff
+	// 重试次数用尽的消息转发到的死信队列
+	DeadLetterQueue string
+}
+
+// @Title 创建分区队列
+// @Param queue 		队列客户端
+// @Param msg 			消息客户端
+// @Param name 			逻辑队列名称
+// @Param partitions 	分区数，小于1时按1处理
+func NewPartitionedQueue(queue *Queue, msg *Message, name string, partitions int) *PartitionedQueue {
+	if partitions < 1 {
+		partitions = 1
+	}
+	return &PartitionedQueue{Queue: queue, Message: msg, Name: name, Partitions: partitions, MaxRetries: 3, Backoff: DefaultBackoff}
+}
+
+// @Title 第i个分区的物理队列名称
+func (this *PartitionedQueue) PartitionName(i int) string {
+	return fmt.Sprintf("%s-p%d", this.Name, i)
+}
+
+// @Title 顺序键所在的分区
+func (this *PartitionedQueue) Partition(key string) int {
+	return partitionOf(key, this.Partitions)
+}
+
+func partitionOf(key string, partitions int) int {
+	if partitions < 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(partitions))
+}
+
+// @Title 创建所有分区的物理队列
+// @Param param 队列参数，同 CreateQueue
+func (this *PartitionedQueue) Create(param map[string]int) error {
+	for i := 0; i < this.Partitions; i++ {
+		if _, err := this.Queue.CreateQueue(this.PartitionName(i), param); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// @Title 按顺序键发送消息
+// @Param key 			顺序键，如客户id
+// @Param messagebody 	消息正文
+// @Param param 		参数，同 SendMessage
+func (this *PartitionedQueue) SendMessage(key, messagebody string, param map[string]int) (string, error) {
+	if this.Partitions < 1 {
+		return "", fmt.Errorf("%w: 分区数为 %d，必须大于0", ErrInvalidParam, this.Partitions)
+	}
+	env := NewEnvelope(messagebody)
+	env.Set(HeaderOrderingKey, key)
+	env.Set(HeaderPartitions, strconv.Itoa(this.Partitions))
+	return this.Message.SendEnvelope(this.PartitionName(this.Partition(key)), env, param)
+}
+
+// @Title 为每个分区创建一个串行处理的消费者
+// @Param ctx 		ctx被取消时停止原地重试
+// @Param handler 	消息处理函数
+func (this *PartitionedQueue) Consumers(ctx context.Context, handler Handler) []*Consumer {
+	if this.Partitions < 1 {
+		return nil
+	}
+	consumers := make([]*Consumer, this.Partitions)
+	for i := range consumers {
+		queuename := this.PartitionName(i)
+		consumers[i] = NewConsumer(this.Message, queuename, this.retry(ctx, queuename, handler))
+	}
+	return consumers
+}
+
+// @Title 消费所有分区，直到ctx被取消
+// @Param handler 消息处理函数
+func (this *PartitionedQueue) Run(ctx context.Context, handler Handler) error {
+	return RunConsumers(ctx, this.Consumers(ctx, handler)...)
+}
+
+// 处理失败时原地重试，避免同一分区的后续消息先被处理。
+// 重试次数用尽后转发到死信队列并返回nil，由消费者从分区删除；
+// 没有死信队列时一直重试，等待期间延长消息的不可见时间
+func (this *PartitionedQueue) retry(ctx context.Context, queuename string, handler Handler) Handler {
+	return func(msg *ReceivedMessage) error {
+		for attempt := 1; ; attempt++ {
+			err := handler(msg)
+			if err == nil {
+				return nil
+			}
+			if this.DeadLetterQueue != "" && attempt > this.MaxRetries {
+				if derr := this.Message.sendDeadLetter(queuename, msg, this.DeadLetterQueue, err.Error(), true); derr != nil {
+					return derr
+				}
+				return nil
+			}
+			delay := this.Backoff.Delay(attempt)
+			if eerr := msg.Extend(delay + partitionRetryTimeout); eerr != nil {
+				log.Printf("队列%s消息%s延长不可见时间失败: %v", queuename, msg.MessageId, eerr)
+			}
+			if !sleep(ctx, delay) {
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// @Title 调整分区数：创建新增的分区，把所有消息按新的分区数重新分配，删除多余的分区。
+// 调整期间应暂停生产者和消费者。多余的分区中还有不可见或延迟的消息时返回错误，不删除分区，
+// 等消息可见后可以用相同的参数再次调用
+// @Param partitions 新的分区数
+// @Param param 		新分区的队列参数，同 CreateQueue
+func (this *PartitionedQueue) Resize(ctx context.Context, partitions int, param map[string]int) error {
+	if partitions < 1 || this.Partitions < 1 {
+		return fmt.Errorf("%w: 分区数为 %d -> %d，必须大于0", ErrInvalidParam, this.Partitions, partitions)
+	}
+	old := this.Partitions
+	for i := old; i < partitions; i++ {
+		// 上次调整中断时分区可能已经创建
+		if _, err := this.Queue.CreateQueue(this.PartitionName(i), param); err != nil && !IsQueueAlreadyExist(err) {
+			return err
+		}
+	}
+	tag := strconv.Itoa(partitions)
+	for i := 0; i < old; i++ {
+		if err := this.repartition(ctx, i, partitions, tag); err != nil {
+			return err
+		}
+	}
+	for i := partitions; i < old; i++ {
+		queuename := this.PartitionName(i)
+		attrs, err := this.Queue.Attributes(queuename)
+		if err != nil {
+			return err
+		}
+		if remaining := attrs.ActiveMessages + attrs.InactiveMessages + attrs.DelayMessages; remaining > 0 {
+			return fmt.Errorf("分区%s中还有%d条不可见或延迟的消息，稍后重试", queuename, remaining)
+		}
+	}
+	for i := partitions; i < old; i++ {
+		if _, err := this.Queue.DeleteQueue(this.PartitionName(i)); err != nil {
+			return err
+		}
+	}
+	this.Partitions = partitions
+	return nil
+}
+
+// 把一个分区中的消息按新的分区数重新发送，已经重新发送过的消息在结束后恢复可见
+func (this *PartitionedQueue) repartition(ctx context.Context, i, partitions int, tag string) error {
+	queuename := this.PartitionName(i)
+	released := []string{}
+	defer func() {
+		for _, handle := range released {
+			this.Message.ChangeMessageVisibility(queuename, handle, 1)
+		}
+	}()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		msg, err := this.Message.Receive(queuename, 0)
+		if err != nil {
+			if IsMessageNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if msg.Header(HeaderPartitions) == tag {
+			released = append(released, msg.ReceiptHandle)
+			continue
+		}
+		env := msg.forwardEnvelope()
+		env.Set(HeaderPartitions, tag)
+		env.Set(HeaderOriginMessageId, msg.OriginMessageId())
+		target := this.PartitionName(partitionOf(msg.Header(HeaderOrderingKey), partitions))
+		if _, err := this.Message.SendEnvelope(target, env, map[string]int{"Priority": msg.Priority}); err != nil {
+			return err
+		}
+		if _, err := this.Message.DeleteMessage(queuename, msg.ReceiptHandle); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package aliyunMQS
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPartitionedQueue(t *testing.T) {
+	Convey("分区队列测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+		partitioned := NewPartitionedQueue(&queue, &msg, "customers", 4)
+		partitioned.Backoff = &Backoff{Initial: time.Millisecond}
+		So(partitioned.Create(nil), ShouldBeNil)
+
+		Convey("同一个键的消息进入同一个分区", func() {
+			for i := 0; i < 3; i++ {
+				_, err := partitioned.SendMessage("c1", fmt.Sprintf("e%d", i), nil)
+				So(err, ShouldBeNil)
+			}
+			So(mock.count(partitioned.PartitionName(partitioned.Partition("c1"))), ShouldEqual, 3)
+		})
+
+		Convey("每个分区串行处理并保持顺序", func() {
+			keys := []string{"c1", "c2", "c3", "c4", "c5"}
+			for i := 0; i < 3; i++ {
+				for _, key := range keys {
+					partitioned.SendMessage(key, fmt.Sprintf("%s-%d", key, i), nil)
+				}
+			}
+			var lock sync.Mutex
+			got := map[string][]string{}
+			failed := false
+			ctx, cancel := context.WithCancel(context.Background())
+			consumers := partitioned.Consumers(ctx, func(m *ReceivedMessage) error {
+				lock.Lock()
+				defer lock.Unlock()
+				key := m.Header(HeaderOrderingKey)
+				// 第一次处理失败时原地重试
+				if m.MessageBody == "c2-0" && !failed {
+					failed = true
+					return errors.New("retry")
+				}
+				got[key] = append(got[key], m.MessageBody)
+				total := 0
+				for _, v := range got {
+					total += len(v)
+				}
+				if total == 15 {
+					cancel()
+				}
+				return nil
+			})
+			for _, c := range consumers {
+				c.WaitSeconds = 0
+				c.ErrorBackoff = time.Millisecond
+			}
+			So(RunConsumers(ctx, consumers...), ShouldEqual, context.Canceled)
+			for _, key := range keys {
+				So(got[key], ShouldResemble, []string{key + "-0", key + "-1", key + "-2"})
+			}
+		})
+
+		Convey("重试次数用尽后转发到死信队列再处理后续消息", func() {
+			queue.CreateQueue("customers-dlq", nil)
+			partitioned.DeadLetterQueue = "customers-dlq"
+			partitioned.MaxRetries = 2
+			partitioned.SendMessage("c1", "bad", nil)
+			partitioned.SendMessage("c1", "good", nil)
+			attempts := 0
+			i := partitioned.Partition("c1")
+			consumer := partitioned.Consumers(context.Background(), func(m *ReceivedMessage) error {
+				if m.MessageBody == "bad" {
+					attempts++
+					return errors.New("bad")
+				}
+				return nil
+			})[i]
+			m, err := msg.Receive(partitioned.PartitionName(i), 0)
+			So(err, ShouldBeNil)
+			So(consumer.Process(m), ShouldBeNil)
+			So(attempts, ShouldEqual, 3)
+			So(mock.count(partitioned.PartitionName(i)), ShouldEqual, 1)
+			So(mock.count("customers-dlq"), ShouldEqual, 1)
+			dead, err := msg.Receive("customers-dlq", 0)
+			So(err, ShouldBeNil)
+			So(dead.Header(HeaderDLQReason), ShouldEqual, "bad")
+			So(dead.Header(HeaderOrderingKey), ShouldEqual, "c1")
+		})
+
+		Convey("没有死信队列时原地重试直到ctx被取消", func() {
+			partitioned.MaxRetries = 0
+			partitioned.Backoff = &Backoff{Initial: time.Hour}
+			partitioned.SendMessage("c1", "bad", nil)
+			i := partitioned.Partition("c1")
+			ctx, cancel := context.WithCancel(context.Background())
+			consumer := partitioned.Consumers(ctx, func(m *ReceivedMessage) error {
+				return errors.New("bad")
+			})[i]
+			m, err := msg.Receive(partitioned.PartitionName(i), 0)
+			So(err, ShouldBeNil)
+			time.AfterFunc(20*time.Millisecond, cancel)
+			start := time.Now()
+			So(consumer.Process(m), ShouldEqual, context.Canceled)
+			So(time.Since(start), ShouldBeLessThan, time.Second)
+			So(mock.count(partitioned.PartitionName(i)), ShouldEqual, 1)
+		})
+
+		Convey("分区数小于1时不会panic", func() {
+			So(NewPartitionedQueue(&queue, &msg, "customers", 0).Partitions, ShouldEqual, 1)
+			partitioned.Partitions = 0
+			So(partitioned.Partition("k"), ShouldEqual, 0)
+			_, err := partitioned.SendMessage("k", "m", nil)
+			So(errors.Is(err, ErrInvalidParam), ShouldBeTrue)
+			So(partitioned.Consumers(context.Background(), nil), ShouldBeEmpty)
+			partitioned.Partitions = 4
+			So(errors.Is(partitioned.Resize(context.Background(), -1, nil), ErrInvalidParam), ShouldBeTrue)
+			So(partitioned.Partitions, ShouldEqual, 4)
+		})
+
+		Convey("缩减的分区中有延迟消息时不删除分区", func() {
+			key := ""
+			for i := 0; key == ""; i++ {
+				if k := fmt.Sprintf("k%d", i); partitioned.Partition(k) >= 2 {
+					key = k
+				}
+			}
+			dropped := partitioned.PartitionName(partitioned.Partition(key))
+			partitioned.SendMessage(key, "later", map[string]int{"DelaySeconds": 3600})
+
+			err := partitioned.Resize(context.Background(), 2, nil)
+			So(err, ShouldNotBeNil)
+			So(partitioned.Partitions, ShouldEqual, 4)
+			So(mock.count(dropped), ShouldEqual, 1)
+
+			// 消息可见后再次调整
+			mock.expire(dropped)
+			So(partitioned.Resize(context.Background(), 2, nil), ShouldBeNil)
+			So(partitioned.Partitions, ShouldEqual, 2)
+			_, err = queue.GetQueueAttributes(dropped)
+			So(IsQueueNotExist(err), ShouldBeTrue)
+			target := partitioned.PartitionName(partitioned.Partition(key))
+			mock.expire(target)
+			m, err := msg.Receive(target, 0)
+			So(err, ShouldBeNil)
+			So(m.MessageBody, ShouldEqual, "later")
+		})
+
+		Convey("调整分区数后消息重新分配", func() {
+			keys := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+			for _, key := range keys {
+				partitioned.SendMessage(key, key, nil)
+			}
+			So(partitioned.Resize(context.Background(), 2, nil), ShouldBeNil)
+			So(partitioned.Partitions, ShouldEqual, 2)
+			_, err := queue.GetQueueAttributes(partitioned.PartitionName(3))
+			So(err, ShouldNotBeNil)
+
+			mock.expire(partitioned.PartitionName(0))
+			mock.expire(partitioned.PartitionName(1))
+			for _, key := range keys {
+				So(mock.count(partitioned.PartitionName(partitioned.Partition(key))), ShouldBeGreaterThan, 0)
+			}
+			So(mock.count(partitioned.PartitionName(0))+mock.count(partitioned.PartitionName(1)), ShouldEqual, 8)
+			for i := 0; i < 2; i++ {
+				for {
+					m, err := msg.Receive(partitioned.PartitionName(i), 0)
+					if err != nil {
+						break
+					}
+					So(partitioned.Partition(m.Header(HeaderOrderingKey)), ShouldEqual, i)
+				}
+			}
+		})
+	})
+}
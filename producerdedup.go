@@ -0,0 +1,89 @@
+package aliyunMQS
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// 生产端去重，记录窗口内已发送的幂等键和发送结果，重复发送时直接返回原结果。
+// 幂等键同时写入信封，服务端已收到但响应丢失的重复消息由消费端 Dedup 去除
+type ProducerDedup struct {
+	Message *Message
+	// 记录保留时间
+	Window time.Duration
+
+	lock     sync.Mutex
+	sent     map[string]*sentRecord
+	inflight map[string]*sync.WaitGroup
+}
+
+type sentRecord struct {
+	content string
+	expire  time.Time
+}
+
+// @Title 创建生产端去重
+// @Param msg 		消息客户端
+// @Param window 	记录保留时间
+func NewProducerDedup(msg *Message, window time.Duration) *ProducerDedup {
+	return &ProducerDedup{
+		Message:  msg,
+		Window:   window,
+		sent:     map[string]*sentRecord{},
+		inflight: map[string]*sync.WaitGroup{},
+	}
+}
+
+// @Title 生成一个随机的幂等键
+func NewIdempotencyKey() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// @Title 发送消息，窗口内相同幂等键只发送一次，返回第一次发送成功的结果
+// @Param queuename 	队列名称
+// @Param key 			幂等键，重试时使用同一个键
+// @Param messagebody 	消息正文
+// @Param param 		参数，同 SendMessage
+func (this *ProducerDedup) SendMessage(queuename, key, messagebody string, param map[string]int) (string, error) {
+	id := queuename + ":" + key
+	for {
+		this.lock.Lock()
+		now := time.Now()
+		for k, v := range this.sent {
+			if !v.expire.After(now) {
+				delete(this.sent, k)
+			}
+		}
+		if record, ok := this.sent[id]; ok {
+			this.lock.Unlock()
+			return record.content, nil
+		}
+		// 相同的键正在发送，等待其结果
+		if wg, ok := this.inflight[id]; ok {
+			this.lock.Unlock()
+			wg.Wait()
+			continue
+		}
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		this.inflight[id] = wg
+		this.lock.Unlock()
+
+		env := NewEnvelope(messagebody)
+		env.Set(HeaderIdempotencyKey, key)
+		content, err := this.Message.SendEnvelope(queuename, env, param)
+
+		this.lock.Lock()
+		if err == nil {
+			this.sent[id] = &sentRecord{content: content, expire: time.Now().Add(this.Window)}
+		}
+		delete(this.inflight, id)
+		this.lock.Unlock()
+		wg.Done()
+		return content, err
+	}
+}
@@ -0,0 +1,67 @@
+package aliyunMQS
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestProducerDedup(t *testing.T) {
+	Convey("生产端去重测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		queue.CreateQueue("events", nil)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+		producer := NewProducerDedup(&msg, time.Minute)
+
+		Convey("相同幂等键返回原结果", func() {
+			key := NewIdempotencyKey()
+			first, err := producer.SendMessage("events", key, "e1", nil)
+			So(err, ShouldBeNil)
+			second, err := producer.SendMessage("events", key, "e1", nil)
+			So(err, ShouldBeNil)
+			So(second, ShouldEqual, first)
+			So(mock.count("events"), ShouldEqual, 1)
+
+			m, _ := msg.Receive("events", 0)
+			So(m.Header(HeaderIdempotencyKey), ShouldEqual, key)
+			So(m.MessageBody, ShouldEqual, "e1")
+		})
+
+		Convey("并发发送相同幂等键只发送一次", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					producer.SendMessage("events", "same", "e", nil)
+				}()
+			}
+			wg.Wait()
+			So(mock.count("events"), ShouldEqual, 1)
+		})
+
+		Convey("不同幂等键和过期后重新发送", func() {
+			producer.SendMessage("events", "a", "e", nil)
+			producer.SendMessage("events", "b", "e", nil)
+			So(mock.count("events"), ShouldEqual, 2)
+			producer.Window = 0
+			producer.SendMessage("events", "c", "e", nil)
+			producer.SendMessage("events", "c", "e", nil)
+			So(mock.count("events"), ShouldEqual, 4)
+		})
+
+		Convey("发送失败不记录", func() {
+			_, err := producer.SendMessage("missing", "k", "e", nil)
+			So(err, ShouldNotBeNil)
+			queue.CreateQueue("missing", nil)
+			_, err = producer.SendMessage("missing", "k", "e", nil)
+			So(err, ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,220 @@
+package aliyunMQS
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// 声明的队列配置，未给出(nil)的属性不做管理
+type QueueConfig struct {
+	Name                   string `json:"Name" yaml:"Name"`
+	DelaySeconds           *int   `json:"DelaySeconds,omitempty" yaml:"DelaySeconds,omitempty"`
+	MaximumMessageSize     *int   `json:"MaximumMessageSize,omitempty" yaml:"MaximumMessageSize,omitempty"`
+	MessageRetentionPeriod *int   `json:"MessageRetentionPeriod,omitempty" yaml:"MessageRetentionPeriod,omitempty"`
+	VisibilityTimeout      *int   `json:"VisibilityTimeout,omitempty" yaml:"VisibilityTimeout,omitempty"`
+	PollingWaitSeconds     *int   `json:"PollingWaitSeconds,omitempty" yaml:"PollingWaitSeconds,omitempty"`
+}
+
+// 给出的属性，同 CreateQueue 的参数
+func (this *QueueConfig) param() map[string]int {
+	param := map[string]int{}
+	set := func(k string, v *int) {
+		if v != nil {
+			param[k] = *v
+		}
+	}
+	set("DelaySeconds", this.DelaySeconds)
+	set("MaximumMessageSize", this.MaximumMessageSize)
+	set("MessageRetentionPeriod", this.MessageRetentionPeriod)
+	set("VisibilityTimeout", this.VisibilityTimeout)
+	set("PollingWaitSeconds", this.PollingWaitSeconds)
+	return param
+}
+
+// 计划中的操作
+type PlanAction int
+
+const (
+	PlanCreate PlanAction = iota
+	PlanUpdate
+	PlanDelete
+)
+
+func (this PlanAction) String() string {
+	switch this {
+	case PlanCreate:
+		return "create"
+	case PlanUpdate:
+		return "update"
+	case PlanDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// 属性的变化
+type AttributeChange struct {
+	Name string
+	Old  int
+	New  int
+}
+
+// 对一个队列的操作
+type PlanItem struct {
+	Action PlanAction
+	Queue  string
+	// 创建时为给出的属性(Old为0)，修改时为有变化的属性
+	Changes []AttributeChange
+}
+
+// 声明的配置与实际队列之间的差异
+type Plan struct {
+	Items []*PlanItem
+}
+
+// @Title 是否没有任何变化
+func (this *Plan) Empty() bool {
+	return len(this.Items) == 0
+}
+
+// @Title 可读的计划，+ 创建，~ 修改，- 删除
+func (this *Plan) String() string {
+	var out strings.Builder
+	for _, item := range this.Items {
+		switch item.Action {
+		case PlanCreate:
+			fmt.Fprintf(&out, "+ %s\n", item.Queue)
+			for _, c := range item.Changes {
+				fmt.Fprintf(&out, "    %s: %d\n", c.Name, c.New)
+			}
+		case PlanUpdate:
+			fmt.Fprintf(&out, "~ %s\n", item.Queue)
+			for _, c := range item.Changes {
+				fmt.Fprintf(&out, "    %s: %d -> %d\n", c.Name, c.Old, c.New)
+			}
+		case PlanDelete:
+			fmt.Fprintf(&out, "- %s\n", item.Queue)
+		}
+	}
+	return out.String()
+}
+
+// Plan 的参数
+type PlanOptions struct {
+	// 只管理以此前缀开头的队列
+	Prefix string
+	// 是否删除前缀范围内未声明的队列。Prefix 为空时还需要指定 PruneAll
+	Prune bool
+	// 允许在 Prefix 为空时删除账号下所有未声明的队列
+	PruneAll bool
+}
+
+// @Title 比较声明的队列与 ListQueue/GetQueueAttributes 得到的实际队列，生成计划
+// @Param declared 	声明的队列
+// @Param opts 		参数
+func (this *Queue) Plan(declared []*QueueConfig, opts PlanOptions) (*Plan, error) {
+	if opts.Prune && opts.Prefix == "" && !opts.PruneAll {
+		return nil, errors.New("未指定前缀时 Prune 会删除所有未声明的队列，需要同时指定 PruneAll")
+	}
+	configs := map[string]*QueueConfig{}
+	for _, config := range declared {
+		if config.Name == "" {
+			return nil, errors.New("队列名称不能为空")
+		}
+		if !strings.HasPrefix(config.Name, opts.Prefix) {
+			return nil, fmt.Errorf("队列%s不在前缀%s范围内", config.Name, opts.Prefix)
+		}
+		if _, ok := configs[config.Name]; ok {
+			return nil, fmt.Errorf("队列%s重复声明", config.Name)
+		}
+		if err := validateParam(config.param(), queueParams); err != nil {
+			return nil, fmt.Errorf("队列%s: %w", config.Name, err)
+		}
+		configs[config.Name] = config
+	}
+
+	existing := map[string]bool{}
+	err := this.ListQueuesEach(ListOptions{Prefix: opts.Prefix}, func(q *QueueInfo) error {
+		existing[q.Name] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	for _, config := range declared {
+		param := config.param()
+		if !existing[config.Name] {
+			item := &PlanItem{Action: PlanCreate, Queue: config.Name}
+			for _, k := range sortedKeys(param) {
+				item.Changes = append(item.Changes, AttributeChange{Name: k, New: param[k]})
+			}
+			plan.Items = append(plan.Items, item)
+			continue
+		}
+		attrs, err := this.Attributes(config.Name)
+		if err != nil {
+			return nil, err
+		}
+		actual := map[string]int{
+			"DelaySeconds":           attrs.DelaySeconds,
+			"MaximumMessageSize":     attrs.MaximumMessageSize,
+			"MessageRetentionPeriod": attrs.MessageRetentionPeriod,
+			"VisibilityTimeout":      attrs.VisibilityTimeout,
+			"PollingWaitSeconds":     attrs.PollingWaitSeconds,
+		}
+		item := &PlanItem{Action: PlanUpdate, Queue: config.Name}
+		for _, k := range sortedKeys(param) {
+			if actual[k] != param[k] {
+				item.Changes = append(item.Changes, AttributeChange{Name: k, Old: actual[k], New: param[k]})
+			}
+		}
+		if len(item.Changes) > 0 {
+			plan.Items = append(plan.Items, item)
+		}
+	}
+	if opts.Prune {
+		for _, name := range sortedKeys(existing) {
+			if configs[name] == nil {
+				plan.Items = append(plan.Items, &PlanItem{Action: PlanDelete, Queue: name})
+			}
+		}
+	}
+	return plan, nil
+}
+
+// @Title 按顺序执行计划，出错时停止，已执行的操作不回滚
+// @Param plan 由 Plan 生成的计划
+func (this *Queue) Apply(plan *Plan) error {
+	for _, item := range plan.Items {
+		param := map[string]int{}
+		for _, c := range item.Changes {
+			param[c.Name] = c.New
+		}
+		var err error
+		switch item.Action {
+		case PlanCreate:
+			_, err = this.CreateQueue(item.Queue, param)
+		case PlanUpdate:
+			_, err = this.SetQueueAttributes(item.Queue, param)
+		case PlanDelete:
+			_, err = this.DeleteQueue(item.Queue)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", item.Action, item.Queue, err)
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
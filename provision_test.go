@@ -0,0 +1,78 @@
+package aliyunMQS
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPlan(t *testing.T) {
+	Convey("声明式队列配置测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		queue.CreateQueue("app-orders", map[string]int{"VisibilityTimeout": 30, "PollingWaitSeconds": 10})
+		queue.CreateQueue("app-old", nil)
+		queue.CreateQueue("other", nil)
+
+		declared := []*QueueConfig{
+			{Name: "app-orders", VisibilityTimeout: Int(60), PollingWaitSeconds: Int(10)},
+			{Name: "app-pay", DelaySeconds: Int(5)},
+		}
+
+		Convey("生成计划", func() {
+			plan, err := queue.Plan(declared, PlanOptions{Prefix: "app-", Prune: true})
+			So(err, ShouldBeNil)
+			So(len(plan.Items), ShouldEqual, 3)
+			So(plan.Items[0].Action, ShouldEqual, PlanUpdate)
+			So(plan.Items[0].Changes, ShouldResemble, []AttributeChange{{Name: "VisibilityTimeout", Old: 30, New: 60}})
+			So(plan.Items[1].Action, ShouldEqual, PlanCreate)
+			So(plan.Items[1].Queue, ShouldEqual, "app-pay")
+			So(plan.Items[2].Action, ShouldEqual, PlanDelete)
+			So(plan.Items[2].Queue, ShouldEqual, "app-old")
+			So(plan.String(), ShouldEqual, "~ app-orders\n    VisibilityTimeout: 30 -> 60\n+ app-pay\n    DelaySeconds: 5\n- app-old\n")
+
+			Convey("执行后没有变化", func() {
+				So(queue.Apply(plan), ShouldBeNil)
+				So(mock.queues, ShouldContainKey, "app-pay")
+				So(mock.queues, ShouldNotContainKey, "app-old")
+				So(mock.queues, ShouldContainKey, "other")
+				So(mock.queues["app-orders"].attrs["VisibilityTimeout"], ShouldEqual, 60)
+
+				plan, err := queue.Plan(declared, PlanOptions{Prefix: "app-", Prune: true})
+				So(err, ShouldBeNil)
+				So(plan.Empty(), ShouldBeTrue)
+			})
+		})
+
+		Convey("不指定 Prune 时不删除", func() {
+			plan, err := queue.Plan(declared, PlanOptions{Prefix: "app-"})
+			So(err, ShouldBeNil)
+			So(len(plan.Items), ShouldEqual, 2)
+		})
+
+		Convey("没有前缀时 Prune 需要 PruneAll", func() {
+			_, err := queue.Plan(declared, PlanOptions{Prune: true})
+			So(err, ShouldNotBeNil)
+			plan, err := queue.Plan(declared, PlanOptions{Prune: true, PruneAll: true})
+			So(err, ShouldBeNil)
+			deleted := []string{}
+			for _, item := range plan.Items {
+				if item.Action == PlanDelete {
+					deleted = append(deleted, item.Queue)
+				}
+			}
+			So(deleted, ShouldContain, "other")
+		})
+
+		Convey("声明错误", func() {
+			_, err := queue.Plan([]*QueueConfig{{Name: "app-a"}, {Name: "app-a"}}, PlanOptions{})
+			So(err, ShouldNotBeNil)
+			_, err = queue.Plan([]*QueueConfig{{Name: "app-a", PollingWaitSeconds: Int(60)}}, PlanOptions{})
+			So(err, ShouldNotBeNil)
+			_, err = queue.Plan([]*QueueConfig{{Name: "other"}}, PlanOptions{Prefix: "app-"})
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
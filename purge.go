@@ -0,0 +1,116 @@
+package aliyunMQS
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 清空队列的参数
+type PurgeOptions struct {
+	// 并发删除的协程数。MQS 没有批量接口，通过并发加快删除
+	Concurrency int
+	// 最长执行时间，0表示不限
+	Timeout time.Duration
+	// 队列统计仍有消息但接收不到时，等待多久再次接收。默认1秒
+	Interval time.Duration
+	// 连续多少轮没有删除任何消息时放弃，默认10
+	MaxIdleRounds int
+}
+
+// @Title 反复接收并删除消息，直到 GetQueueAttributes 返回的 ActiveMessages 为0，队列属性保持不变。
+// 正在被其他消费者处理的消息和延迟消息不会被删除
+// @Param queuename 队列名称
+// @Param opts 		参数
+func (this *Queue) PurgeQueue(ctx context.Context, queuename string, opts PurgeOptions) (int, error) {
+	parent := ctx
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	maxidle := opts.MaxIdleRounds
+	if maxidle <= 0 {
+		maxidle = 10
+	}
+	idle := 0
+	// 原样接收，不解密、不校验签名
+	message := &Message{MQS: this.MQS}
+	var deleted atomic.Int64
+	for {
+		before := deleted.Load()
+		var wg sync.WaitGroup
+		var once sync.Once
+		var failure error
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for ctx.Err() == nil {
+					content, err := message.receiveMessage(queuename, 0)
+					if err != nil {
+						if !IsMessageNotExist(err) {
+							once.Do(func() { failure = err })
+						}
+						return
+					}
+					msg, err := ParseReceivedMessage(content)
+					if err != nil {
+						once.Do(func() { failure = err })
+						return
+					}
+					if _, err := message.DeleteMessage(queuename, msg.ReceiptHandle); err != nil {
+						once.Do(func() { failure = err })
+						return
+					}
+					deleted.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		n := int(deleted.Load())
+		if failure != nil {
+			return n, failure
+		}
+		if err := ctx.Err(); err != nil {
+			return n, purgeStopped(parent, queuename, n, err)
+		}
+		attrs, err := this.Attributes(queuename)
+		if err != nil {
+			return n, err
+		}
+		if attrs.ActiveMessages == 0 {
+			return n, nil
+		}
+		// 统计有延迟，接收不到消息时等待后再试
+		if deleted.Load() == before {
+			idle++
+			if idle >= maxidle {
+				return n, fmt.Errorf("队列%s统计还有%d条消息，但连续%d轮接收不到", queuename, attrs.ActiveMessages, idle)
+			}
+		} else {
+			idle = 0
+		}
+		if !sleep(ctx, interval) {
+			return n, purgeStopped(parent, queuename, n, ctx.Err())
+		}
+	}
+}
+
+// 调用方取消时返回取消原因，超过 Timeout 时返回超时错误
+func purgeStopped(parent context.Context, queuename string, n int, err error) error {
+	if perr := parent.Err(); perr != nil {
+		return perr
+	}
+	return fmt.Errorf("清空队列%s超时，已删除%d条消息: %w", queuename, n, err)
+}
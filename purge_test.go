@@ -0,0 +1,63 @@
+package aliyunMQS
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPurgeQueue(t *testing.T) {
+	Convey("清空队列测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		var message Message
+		mock.NewMQS(&queue.MQS)
+		mock.NewMQS(&message.MQS)
+		queue.CreateQueue("purge", map[string]int{"VisibilityTimeout": 120})
+		for i := 0; i < 30; i++ {
+			message.SendMessage("purge", fmt.Sprintf("m%d", i), nil)
+		}
+
+		Convey("删除所有消息并保留属性", func() {
+			n, err := queue.PurgeQueue(context.Background(), "purge", PurgeOptions{Concurrency: 4})
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 30)
+			So(mock.count("purge"), ShouldEqual, 0)
+			attrs, err := queue.Attributes("purge")
+			So(err, ShouldBeNil)
+			So(attrs.VisibilityTimeout, ShouldEqual, 120)
+		})
+
+		Convey("取消时返回取消原因", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err := queue.PurgeQueue(ctx, "purge", PurgeOptions{Timeout: time.Second})
+			So(err, ShouldEqual, context.Canceled)
+			So(mock.count("purge"), ShouldEqual, 30)
+		})
+
+		Convey("统计有消息但接收不到时等待并放弃", func() {
+			// 消息都不可见，但统计仍计为可见
+			mock.lock.Lock()
+			for _, m := range mock.queues["purge"].messages {
+				m.dequeueCount = 1
+				m.visible = time.Now().Add(time.Hour)
+			}
+			mock.lagging = true
+			mock.lock.Unlock()
+			start := time.Now()
+			n, err := queue.PurgeQueue(context.Background(), "purge", PurgeOptions{Interval: 20 * time.Millisecond, MaxIdleRounds: 3})
+			So(err, ShouldNotBeNil)
+			So(n, ShouldEqual, 0)
+			So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 40*time.Millisecond)
+
+			_, err = queue.PurgeQueue(context.Background(), "purge", PurgeOptions{Interval: time.Hour, Timeout: 50 * time.Millisecond})
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "超时")
+		})
+	})
+}
@@ -0,0 +1,83 @@
+package aliyunMQS
+
+// 要修改的队列属性，只发送不为nil的字段
+type QueueAttributesUpdate struct {
+	DelaySeconds           *int `xml:"DelaySeconds,omitempty"`
+	MaximumMessageSize     *int `xml:"MaximumMessageSize,omitempty"`
+	MessageRetentionPeriod *int `xml:"MessageRetentionPeriod,omitempty"`
+	VisibilityTimeout      *int `xml:"VisibilityTimeout,omitempty"`
+	PollingWaitSeconds     *int `xml:"PollingWaitSeconds,omitempty"`
+}
+
+// @Title 返回v的指针，用于填写 QueueAttributesUpdate
+func Int(v int) *int {
+	return &v
+}
+
+// 不为nil的字段转换成 SetQueueAttributes 的参数，用于校验取值范围
+func (this *QueueAttributesUpdate) params() map[string]int {
+	param := map[string]int{}
+	fields := map[string]*int{
+		"DelaySeconds":           this.DelaySeconds,
+		"MaximumMessageSize":     this.MaximumMessageSize,
+		"MessageRetentionPeriod": this.MessageRetentionPeriod,
+		"VisibilityTimeout":      this.VisibilityTimeout,
+		"PollingWaitSeconds":     this.PollingWaitSeconds,
+	}
+	for k, v := range fields {
+		if v != nil {
+			param[k] = *v
+		}
+	}
+	return param
+}
+
+// 把 SetQueueAttributes 的参数转换成 QueueAttributesUpdate，未给出的属性为nil
+func newAttributesUpdate(param map[string]int) *QueueAttributesUpdate {
+	update := &QueueAttributesUpdate{}
+	fields := map[string]**int{
+		"DelaySeconds":           &update.DelaySeconds,
+		"MaximumMessageSize":     &update.MaximumMessageSize,
+		"MessageRetentionPeriod": &update.MessageRetentionPeriod,
+		"VisibilityTimeout":      &update.VisibilityTimeout,
+		"PollingWaitSeconds":     &update.PollingWaitSeconds,
+	}
+	for k, v := range param {
+		if field, ok := fields[k]; ok {
+			*field = Int(v)
+		}
+	}
+	return update
+}
+
+// @Title 读取队列属性，交给fn修改后只提交有变化的属性。没有变化时不发送请求
+// @Param queuename 队列名称
+// @Param fn 		修改属性的函数，返回错误时不提交
+func (this *Queue) ModifyQueueAttributes(queuename string, fn func(attrs *QueueAttributes) error) error {
+	attrs, err := this.Attributes(queuename)
+	if err != nil {
+		return err
+	}
+	modified := *attrs
+	if err := fn(&modified); err != nil {
+		return err
+	}
+	update := &QueueAttributesUpdate{}
+	changed := false
+	diff := func(field **int, old, new int) {
+		if old != new {
+			*field = Int(new)
+			changed = true
+		}
+	}
+	diff(&update.DelaySeconds, attrs.DelaySeconds, modified.DelaySeconds)
+	diff(&update.MaximumMessageSize, attrs.MaximumMessageSize, modified.MaximumMessageSize)
+	diff(&update.MessageRetentionPeriod, attrs.MessageRetentionPeriod, modified.MessageRetentionPeriod)
+	diff(&update.VisibilityTimeout, attrs.VisibilityTimeout, modified.VisibilityTimeout)
+	diff(&update.PollingWaitSeconds, attrs.PollingWaitSeconds, modified.PollingWaitSeconds)
+	if !changed {
+		return nil
+	}
+	_, err = this.UpdateQueueAttributes(queuename, update)
+	return err
+}
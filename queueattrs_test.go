@@ -0,0 +1,73 @@
+package aliyunMQS
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQueueAttributesUpdate(t *testing.T) {
+	Convey("部分修改队列属性测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		_, err := queue.CreateQueue("attrs", map[string]int{"VisibilityTimeout": 60, "PollingWaitSeconds": 10})
+		So(err, ShouldBeNil)
+
+		Convey("SetQueueAttributes 只修改给出的属性", func() {
+			_, err := queue.SetQueueAttributes("attrs", map[string]int{"DelaySeconds": 5})
+			So(err, ShouldBeNil)
+			attrs, err := queue.Attributes("attrs")
+			So(err, ShouldBeNil)
+			So(attrs.DelaySeconds, ShouldEqual, 5)
+			So(attrs.VisibilityTimeout, ShouldEqual, 60)
+			So(attrs.PollingWaitSeconds, ShouldEqual, 10)
+		})
+
+		Convey("UpdateQueueAttributes 可以把属性改为0", func() {
+			_, err := queue.UpdateQueueAttributes("attrs", &QueueAttributesUpdate{PollingWaitSeconds: Int(0)})
+			So(err, ShouldBeNil)
+			attrs, _ := queue.Attributes("attrs")
+			So(attrs.PollingWaitSeconds, ShouldEqual, 0)
+			So(attrs.VisibilityTimeout, ShouldEqual, 60)
+		})
+
+		Convey("取值范围错误时不发送请求", func() {
+			start := mock.requestCount()
+			_, err := queue.UpdateQueueAttributes("attrs", &QueueAttributesUpdate{VisibilityTimeout: Int(0)})
+			So(errors.Is(err, ErrInvalidParam), ShouldBeTrue)
+			So(mock.requestCount(), ShouldEqual, start)
+
+			err = queue.ModifyQueueAttributes("attrs", func(attrs *QueueAttributes) error {
+				attrs.PollingWaitSeconds = 31
+				return nil
+			})
+			So(errors.Is(err, ErrInvalidParam), ShouldBeTrue)
+			attrs, _ := queue.Attributes("attrs")
+			So(attrs.VisibilityTimeout, ShouldEqual, 60)
+			So(attrs.PollingWaitSeconds, ShouldEqual, 10)
+		})
+
+		Convey("ModifyQueueAttributes 读取后修改", func() {
+			err := queue.ModifyQueueAttributes("attrs", func(attrs *QueueAttributes) error {
+				attrs.VisibilityTimeout *= 2
+				return nil
+			})
+			So(err, ShouldBeNil)
+			attrs, _ := queue.Attributes("attrs")
+			So(attrs.VisibilityTimeout, ShouldEqual, 120)
+			So(attrs.PollingWaitSeconds, ShouldEqual, 10)
+
+			stop := errors.New("stop")
+			err = queue.ModifyQueueAttributes("attrs", func(attrs *QueueAttributes) error {
+				attrs.VisibilityTimeout = 1
+				return stop
+			})
+			So(err, ShouldEqual, stop)
+			attrs, _ = queue.Attributes("attrs")
+			So(attrs.VisibilityTimeout, ShouldEqual, 120)
+		})
+	})
+}
@@ -0,0 +1,179 @@
+package aliyunMQS
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Redis兼容的去重存储，通过RESP协议访问Redis或兼容服务
+type RedisDedupStore struct {
+	Addr     string
+	Password string
+	DB       int
+	// 键前缀
+	Prefix string
+	// 连接和读写超时
+	Timeout time.Duration
+
+	lock   sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// @Title 创建Redis去重存储
+// @Param addr 服务地址，如 127.0.0.1:6379
+func NewRedisDedupStore(addr string) *RedisDedupStore {
+	return &RedisDedupStore{Addr: addr, Prefix: "mqs:dedup:", Timeout: 5 * time.Second}
+}
+
+func (this *RedisDedupStore) Claim(key string, lease time.Duration) (DedupState, error) {
+	for {
+		reply, err := this.do("SET", this.Prefix+key, strconv.Itoa(int(DedupProcessing)), "NX", "PX", strconv.FormatInt(int64(lease/time.Millisecond), 10))
+		if err != nil || reply != nil {
+			return DedupNew, err
+		}
+		reply, err = this.do("GET", this.Prefix+key)
+		if err != nil {
+			return DedupNew, err
+		}
+		// 两次请求之间键已过期，重新占用
+		if reply == nil {
+			continue
+		}
+		state, err := strconv.Atoi(reply.(string))
+		return DedupState(state), err
+	}
+}
+
+func (this *RedisDedupStore) Commit(key string, retention time.Duration) error {
+	_, err := this.do("SET", this.Prefix+key, strconv.Itoa(int(DedupDone)), "PX", strconv.FormatInt(int64(retention/time.Millisecond), 10))
+	return err
+}
+
+func (this *RedisDedupStore) Release(key string) error {
+	_, err := this.do("DEL", this.Prefix+key)
+	return err
+}
+
+// @Title 关闭连接
+func (this *RedisDedupStore) Close() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.conn == nil {
+		return nil
+	}
+	err := this.conn.Close()
+	this.conn = nil
+	return err
+}
+
+// 执行一条命令，返回 string、int64 或 nil。出错时断开连接，下次请求重新连接
+func (this *RedisDedupStore) do(args ...string) (interface{}, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.conn == nil {
+		if err := this.connect(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := this.command(args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		this.conn.Close()
+		this.conn = nil
+	}
+	return reply, err
+}
+
+func (this *RedisDedupStore) connect() error {
+	conn, err := net.DialTimeout("tcp", this.Addr, this.Timeout)
+	if err != nil {
+		return err
+	}
+	this.conn = conn
+	this.reader = bufio.NewReader(conn)
+	if this.Password != "" {
+		if _, err := this.command("AUTH", this.Password); err != nil {
+			conn.Close()
+			this.conn = nil
+			return err
+		}
+	}
+	if this.DB != 0 {
+		if _, err := this.command("SELECT", strconv.Itoa(this.DB)); err != nil {
+			conn.Close()
+			this.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+func (this *RedisDedupStore) command(args ...string) (interface{}, error) {
+	if this.Timeout > 0 {
+		this.conn.SetDeadline(time.Now().Add(this.Timeout))
+	}
+	w := bufio.NewWriter(this.conn)
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return readRESP(this.reader)
+}
+
+// Redis返回的错误
+type redisError string
+
+func (this redisError) Error() string {
+	return "redis: " + string(this)
+}
+
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: 错误的响应 " + strconv.Quote(line))
+	}
+	line = line[:len(line)-2]
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = readRESP(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, errors.New("redis: 错误的响应 " + strconv.Quote(line))
+}
@@ -0,0 +1,154 @@
+package aliyunMQS
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 重新投递死信的参数
+type RedriveOptions struct {
+	// 只重新投递返回true的消息，为nil时全部投递
+	Filter func(msg *ReceivedMessage) bool
+	// 投递前修改信封，可以改写正文或头信息
+	Transform func(env *Envelope) error
+	// 没有记录原队列的消息投递到此队列
+	DefaultQueue string
+	// 每秒最多投递的消息数，0表示不限
+	Rate float64
+	// 最多处理的消息数，0表示直到死信队列为空
+	Limit int
+	// 只统计不投递
+	DryRun bool
+}
+
+// 重新投递的结果
+type RedriveResult struct {
+	// 从死信队列接收的消息数
+	Received int
+	// 成功投递回原队列的消息数
+	Redriven int
+	// 被 Filter 跳过或 DryRun 时未投递的消息数
+	Skipped int
+	// 投递失败的消息数
+	Failed int
+}
+
+// @Title 从死信队列接收消息，重新投递到信封中记录的原队列并从死信队列删除
+// @Param deadletter 	死信队列名称
+// @Param opts 			参数
+func (this *Message) Redrive(ctx context.Context, deadletter string, opts RedriveOptions) (*RedriveResult, error) {
+	result := &RedriveResult{}
+	// 跳过和失败的消息在结束后恢复可见
+	released := []string{}
+	defer func() {
+		for _, handle := range released {
+			this.ChangeMessageVisibility(deadletter, handle, 1)
+		}
+	}()
+
+	var interval time.Duration
+	if opts.Rate > 0 {
+		interval = time.Duration(float64(time.Second) / opts.Rate)
+	}
+	for opts.Limit <= 0 || result.Received < opts.Limit {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		// 死信中可能有签名校验失败或未加密的消息，接收原始消息，不校验签名
+		content, err := this.receiveMessage(deadletter, 0)
+		if err != nil {
+			if IsMessageNotExist(err) {
+				return result, nil
+			}
+			return result, err
+		}
+		msg, err := ParseReceivedMessage(content)
+		if err != nil {
+			return result, err
+		}
+		msg.client = this
+		msg.queuename = deadletter
+		result.Received++
+		if err := this.openDeadLetter(msg); err != nil {
+			result.Failed++
+			released = append(released, msg.ReceiptHandle)
+			continue
+		}
+
+		if opts.DryRun || (opts.Filter != nil && !opts.Filter(msg)) {
+			result.Skipped++
+			released = append(released, msg.ReceiptHandle)
+			continue
+		}
+		if err := this.redrive(deadletter, msg, opts); err != nil {
+			result.Failed++
+			released = append(released, msg.ReceiptHandle)
+			continue
+		}
+		result.Redriven++
+		if interval > 0 && !sleep(ctx, interval) {
+			return result, ctx.Err()
+		}
+	}
+	return result, nil
+}
+
+// 解开死信中的信封，只解密加密过的信封
+func (this *Message) openDeadLetter(msg *ReceivedMessage) error {
+	env, ok := DecodeEnvelope(msg.MessageBody)
+	if !ok {
+		return nil
+	}
+	if env.Get(HeaderEncKeyId) != "" {
+		if this.Encryptor == nil {
+			return errors.New("消息" + msg.MessageId + "已加密，未配置 Encryptor")
+		}
+		if err := this.Encryptor.Open(env); err != nil {
+			return err
+		}
+	}
+	msg.Envelope = env
+	msg.MessageBody = env.Body
+	return nil
+}
+
+func (this *Message) redrive(deadletter string, msg *ReceivedMessage, opts RedriveOptions) error {
+	queuename := msg.Header(HeaderDLQSourceQueue)
+	if queuename == "" {
+		queuename = opts.DefaultQueue
+	}
+	if queuename == "" {
+		return errors.New("消息" + msg.MessageId + "未记录原队列")
+	}
+	env := msg.forwardEnvelope()
+	if msg.Envelope != nil {
+		for _, h := range msg.Envelope.Headers {
+			if strings.HasPrefix(h.Name, "x-dlq-") {
+				env.Del(h.Name)
+			}
+		}
+	}
+	if opts.Transform != nil {
+		if err := opts.Transform(env); err != nil {
+			return err
+		}
+	}
+	param := map[string]int{}
+	if priority, err := strconv.Atoi(msg.Header(HeaderDLQPriority)); err == nil && priority > 0 {
+		param["Priority"] = priority
+	}
+	var err error
+	if len(env.Headers) == 0 && !this.useEnvelope() {
+		_, err = this.sendMessage(queuename, env.Body, param)
+	} else {
+		_, err = this.SendEnvelope(queuename, env, param)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = this.DeleteMessage(deadletter, msg.ReceiptHandle)
+	return err
+}
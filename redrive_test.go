@@ -0,0 +1,123 @@
+package aliyunMQS
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRedrive(t *testing.T) {
+	Convey("死信重新投递测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		queue.CreateQueue("orders", nil)
+		queue.CreateQueue("orders-dlq", nil)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+
+		// 产生两条死信
+		consumer := NewConsumer(&msg, "orders", func(m *ReceivedMessage) error {
+			return errors.New("bug")
+		})
+		consumer.DeadLetter = &DeadLetterPolicy{Queue: "orders-dlq", MaxDeliveries: 1}
+		for _, body := range []string{"a", "b"} {
+			msg.SendMessage("orders", body, nil)
+			m, err := msg.Receive("orders", 0)
+			So(err, ShouldBeNil)
+			consumer.Process(m)
+		}
+		So(mock.count("orders-dlq"), ShouldEqual, 2)
+
+		Convey("DryRun不投递", func() {
+			result, err := msg.Redrive(context.Background(), "orders-dlq", RedriveOptions{DryRun: true})
+			So(err, ShouldBeNil)
+			So(*result, ShouldResemble, RedriveResult{Received: 2, Skipped: 2})
+			So(mock.count("orders-dlq"), ShouldEqual, 2)
+			So(mock.count("orders"), ShouldEqual, 0)
+		})
+
+		Convey("过滤并改写后投递回原队列", func() {
+			result, err := msg.Redrive(context.Background(), "orders-dlq", RedriveOptions{
+				Filter: func(m *ReceivedMessage) bool { return m.MessageBody == "a" },
+				Transform: func(env *Envelope) error {
+					env.Body = env.Body + "-fixed"
+					return nil
+				},
+				Rate: 1000,
+			})
+			So(err, ShouldBeNil)
+			So(*result, ShouldResemble, RedriveResult{Received: 2, Redriven: 1, Skipped: 1})
+			So(mock.count("orders-dlq"), ShouldEqual, 1)
+
+			m, err := msg.Receive("orders", 0)
+			So(err, ShouldBeNil)
+			So(m.MessageBody, ShouldEqual, "a-fixed")
+			So(m.Header(HeaderDLQReason), ShouldEqual, "")
+		})
+	})
+}
+
+func TestRedriveSecured(t *testing.T) {
+	Convey("加密签名的死信重新投递测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		queue.CreateQueue("orders", nil)
+		queue.CreateQueue("orders-dlq", nil)
+
+		keyring := NewKeyring()
+		So(keyring.Rotate("k1"), ShouldBeNil)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+		msg.Encryptor = NewEncryptor(keyring)
+		msg.Signer = NewSigner("p1", "secret")
+		msg.Signer.Policy = SignPolicyDeadLetter
+		msg.Signer.DeadLetterQueue = "orders-dlq"
+
+		// 处理失败的消息加密签名后进入死信队列
+		consumer := NewConsumer(&msg, "orders", func(m *ReceivedMessage) error {
+			return errors.New("bug")
+		})
+		consumer.DeadLetter = &DeadLetterPolicy{Queue: "orders-dlq", MaxDeliveries: 1}
+		msg.SendMessage("orders", "a", nil)
+		m, err := msg.Receive("orders", 0)
+		So(err, ShouldBeNil)
+		consumer.Process(m)
+
+		// 未签名的消息原样转发到死信队列，没有加密头
+		var untrusted Message
+		mock.NewMQS(&untrusted.MQS)
+		untrusted.SendMessage("orders", "forged", nil)
+		_, err = msg.Receive("orders", 0)
+		So(errors.Is(err, ErrInvalidSignature), ShouldBeTrue)
+		So(mock.count("orders-dlq"), ShouldEqual, 2)
+
+		Convey("两种死信都能投递回原队列", func() {
+			result, err := msg.Redrive(context.Background(), "orders-dlq", RedriveOptions{})
+			So(err, ShouldBeNil)
+			So(*result, ShouldResemble, RedriveResult{Received: 2, Redriven: 2})
+			bodies := []string{}
+			for i := 0; i < 2; i++ {
+				m, err := msg.Receive("orders", 0)
+				So(err, ShouldBeNil)
+				bodies = append(bodies, m.MessageBody)
+			}
+			So(bodies, ShouldResemble, []string{"a", "forged"})
+		})
+
+		Convey("无法解密的消息计为失败，不中止", func() {
+			other := NewKeyring()
+			So(other.Rotate("k2"), ShouldBeNil)
+			msg.Encryptor = NewEncryptor(other)
+			result, err := msg.Redrive(context.Background(), "orders-dlq", RedriveOptions{})
+			So(err, ShouldBeNil)
+			So(*result, ShouldResemble, RedriveResult{Received: 2, Redriven: 1, Failed: 1})
+			So(mock.count("orders-dlq"), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,195 @@
+package aliyunMQS
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// @Title 按已有队列的属性创建新队列，不复制消息
+// @Param source 	已有队列名称
+// @Param target 	新队列名称
+func (this *Queue) CloneQueue(source, target string) error {
+	attrs, err := this.Attributes(source)
+	if err != nil {
+		return err
+	}
+	_, err = this.CreateQueue(target, map[string]int{
+		"DelaySeconds":           attrs.DelaySeconds,
+		"MaximumMessageSize":     attrs.MaximumMessageSize,
+		"MessageRetentionPeriod": attrs.MessageRetentionPeriod,
+		"VisibilityTimeout":      attrs.VisibilityTimeout,
+		"PollingWaitSeconds":     attrs.PollingWaitSeconds,
+	})
+	return err
+}
+
+// 重命名的步骤
+type RenameStep string
+
+const (
+	RenameStarted  RenameStep = "started"
+	RenameCloned   RenameStep = "cloned"
+	RenameMigrated RenameStep = "migrated"
+	RenameSwitched RenameStep = "switched"
+	RenameDrained  RenameStep = "drained"
+	RenameDone     RenameStep = "done"
+)
+
+// 重命名的进度，保存在状态文件中
+type RenameState struct {
+	Source string     `json:"Source"`
+	Target string     `json:"Target"`
+	Step   RenameStep `json:"Step"`
+	// 已迁移的消息数
+	Migrated int `json:"Migrated"`
+}
+
+// 重命名参数
+type RenameOptions struct {
+	// 状态文件，中断后用相同的参数再次调用时从中断的步骤继续
+	StateFile string
+	// 迁移消息的并发数
+	Concurrency int
+	// 第一次迁移完成后调用，在其中把生产者和消费者切换到新队列。
+	// 返回后再次迁移切换前写入原队列的消息，然后删除原队列
+	SwitchOver func(ctx context.Context) error
+}
+
+// @Title 重命名队列：克隆属性、迁移消息、切换、再次迁移、删除原队列。
+// 原队列中还有不可见或延迟的消息时不删除并返回错误，稍后再次调用即可继续
+// @Param source 	原队列名称
+// @Param target 	新队列名称
+// @Param opts 		参数
+func (this *Queue) RenameQueue(ctx context.Context, source, target string, opts RenameOptions) (*RenameState, error) {
+	if source == target {
+		return nil, errors.New("新队列名称与原队列相同")
+	}
+	state, err := loadRenameState(opts.StateFile, source, target)
+	if err != nil {
+		return nil, err
+	}
+	// 原样迁移，不解密、不校验签名
+	message := &Message{MQS: this.MQS}
+	migrate := func() error {
+		result, err := Migrate(ctx, message, source, message, target, MigrateOptions{Concurrency: opts.Concurrency})
+		if result != nil {
+			state.Migrated += result.Migrated
+		}
+		return err
+	}
+	for state.Step != RenameDone {
+		var err error
+		next := state.Step
+		switch state.Step {
+		case RenameStarted:
+			err = this.CloneQueue(source, target)
+			if IsQueueAlreadyExist(err) {
+				// 上次克隆后保存状态前中断，新队列应与原队列属性相同且为空
+				err = this.checkClone(source, target)
+			}
+			next = RenameCloned
+		case RenameCloned:
+			err = migrate()
+			next = RenameMigrated
+		case RenameMigrated:
+			if opts.SwitchOver != nil {
+				err = opts.SwitchOver(ctx)
+			}
+			next = RenameSwitched
+		case RenameSwitched:
+			err = migrate()
+			next = RenameDrained
+		case RenameDrained:
+			var attrs *QueueAttributes
+			attrs, err = this.Attributes(source)
+			if IsQueueNotExist(err) {
+				// 上次删除后保存状态前中断
+				err = nil
+			} else if err == nil && attrs.ActiveMessages+attrs.InactiveMessages+attrs.DelayMessages > 0 {
+				// 回到上一步，再次调用时继续迁移
+				state.Step = RenameSwitched
+				err = fmt.Errorf("原队列%s中还有%d条不可见或延迟的消息", source, attrs.ActiveMessages+attrs.InactiveMessages+attrs.DelayMessages)
+			} else if err == nil {
+				_, err = this.DeleteQueue(source)
+				if IsQueueNotExist(err) {
+					err = nil
+				}
+			}
+			next = RenameDone
+		default:
+			return state, fmt.Errorf("未知的步骤%s", state.Step)
+		}
+		if err != nil {
+			if serr := state.save(opts.StateFile); serr != nil {
+				return state, serr
+			}
+			return state, err
+		}
+		state.Step = next
+		if err := state.save(opts.StateFile); err != nil {
+			return state, err
+		}
+	}
+	return state, nil
+}
+
+// 已存在的新队列必须与原队列属性相同且为空，避免把消息迁移到无关的队列
+func (this *Queue) checkClone(source, target string) error {
+	from, err := this.Attributes(source)
+	if err != nil {
+		return err
+	}
+	to, err := this.Attributes(target)
+	if err != nil {
+		return err
+	}
+	if from.DelaySeconds != to.DelaySeconds || from.MaximumMessageSize != to.MaximumMessageSize ||
+		from.MessageRetentionPeriod != to.MessageRetentionPeriod || from.VisibilityTimeout != to.VisibilityTimeout ||
+		from.PollingWaitSeconds != to.PollingWaitSeconds {
+		return fmt.Errorf("队列%s已存在且属性与%s不同", target, source)
+	}
+	if to.ActiveMessages+to.InactiveMessages+to.DelayMessages > 0 {
+		return fmt.Errorf("队列%s已存在且不为空", target)
+	}
+	return nil
+}
+
+// 读取状态文件，不存在时从头开始
+func loadRenameState(path, source, target string) (*RenameState, error) {
+	state := &RenameState{Source: source, Target: target, Step: RenameStarted}
+	if path == "" {
+		return state, nil
+	}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if state.Source != source || state.Target != target {
+		return nil, fmt.Errorf("状态文件%s记录的是%s到%s的重命名", path, state.Source, state.Target)
+	}
+	return state, nil
+}
+
+func (this *RenameState) save(path string) error {
+	if path == "" {
+		return nil
+	}
+	content, err := json.MarshalIndent(this, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,103 @@
+package aliyunMQS
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRenameQueue(t *testing.T) {
+	Convey("克隆和重命名测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		var message Message
+		mock.NewMQS(&queue.MQS)
+		mock.NewMQS(&message.MQS)
+		queue.CreateQueue("old", map[string]int{"VisibilityTimeout": 90, "PollingWaitSeconds": 5})
+		for i := 0; i < 3; i++ {
+			message.SendMessage("old", "m", nil)
+		}
+
+		Convey("克隆属性", func() {
+			So(queue.CloneQueue("old", "copy"), ShouldBeNil)
+			attrs, err := queue.Attributes("copy")
+			So(err, ShouldBeNil)
+			So(attrs.VisibilityTimeout, ShouldEqual, 90)
+			So(attrs.PollingWaitSeconds, ShouldEqual, 5)
+			So(mock.count("copy"), ShouldEqual, 0)
+		})
+
+		Convey("中断后从状态文件继续", func() {
+			statefile := filepath.Join(t.TempDir(), "rename.json")
+			opts := RenameOptions{StateFile: statefile, Concurrency: 2}
+			opts.SwitchOver = func(ctx context.Context) error {
+				// 切换前生产者又写入一条
+				message.SendMessage("old", "late", nil)
+				return errors.New("interrupted")
+			}
+			state, err := queue.RenameQueue(context.Background(), "old", "new", opts)
+			So(err, ShouldNotBeNil)
+			So(state.Step, ShouldEqual, RenameMigrated)
+			So(mock.count("new"), ShouldEqual, 3)
+
+			_, err = queue.RenameQueue(context.Background(), "old", "other", opts)
+			So(err, ShouldNotBeNil)
+
+			switched := 0
+			opts.SwitchOver = func(ctx context.Context) error {
+				switched++
+				return nil
+			}
+			state, err = queue.RenameQueue(context.Background(), "old", "new", opts)
+			So(err, ShouldBeNil)
+			So(switched, ShouldEqual, 1)
+			So(state.Step, ShouldEqual, RenameDone)
+			So(state.Migrated, ShouldEqual, 4)
+			So(mock.count("new"), ShouldEqual, 4)
+			So(mock.queues, ShouldNotContainKey, "old")
+			So(mock.queues["new"].attrs["VisibilityTimeout"], ShouldEqual, 90)
+
+			loaded, err := loadRenameState(statefile, "old", "new")
+			So(err, ShouldBeNil)
+			So(loaded.Step, ShouldEqual, RenameDone)
+		})
+
+		Convey("新队列已存在时检查属性", func() {
+			queue.CreateQueue("unrelated", map[string]int{"VisibilityTimeout": 30})
+			_, err := queue.RenameQueue(context.Background(), "old", "unrelated", RenameOptions{})
+			So(err, ShouldNotBeNil)
+			So(mock.count("old"), ShouldEqual, 3)
+
+			// 克隆后中断
+			So(queue.CloneQueue("old", "new"), ShouldBeNil)
+			state, err := queue.RenameQueue(context.Background(), "old", "new", RenameOptions{})
+			So(err, ShouldBeNil)
+			So(state.Step, ShouldEqual, RenameDone)
+		})
+
+		Convey("删除原队列后保存状态前中断", func() {
+			statefile := filepath.Join(t.TempDir(), "rename.json")
+			state := &RenameState{Source: "old", Target: "new", Step: RenameDrained}
+			So(state.save(statefile), ShouldBeNil)
+			queue.CreateQueue("new", nil)
+			queue.DeleteQueue("old")
+			state, err := queue.RenameQueue(context.Background(), "old", "new", RenameOptions{StateFile: statefile})
+			So(err, ShouldBeNil)
+			So(state.Step, ShouldEqual, RenameDone)
+		})
+
+		Convey("原队列中还有不可见的消息时不删除", func() {
+			_, err := message.Receive("old", 0)
+			So(err, ShouldBeNil)
+			state, err := queue.RenameQueue(context.Background(), "old", "new", RenameOptions{})
+			So(err, ShouldNotBeNil)
+			So(state.Step, ShouldEqual, RenameSwitched)
+			So(mock.queues, ShouldContainKey, "old")
+			So(mock.count("new"), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,159 @@
+package aliyunMQS
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// ReceiveMessage/PeekMessage 返回的消息
+type ReceivedMessage struct {
+	XMLName          xml.Name `xml:"Message"`
+	MessageId        string   `xml:"MessageId"`
+	ReceiptHandle    string   `xml:"ReceiptHandle,omitempty"`
+	MessageBodyMD5   string   `xml:"MessageBodyMD5"`
+	MessageBody      string   `xml:"MessageBody"`
+	EnqueueTime      int64    `xml:"EnqueueTime"`
+	NextVisibleTime  int64    `xml:"NextVisibleTime,omitempty"`
+	FirstDequeueTime int64    `xml:"FirstDequeueTime,omitempty"`
+	DequeueCount     int      `xml:"DequeueCount"`
+	Priority         int      `xml:"Priority"`
+
+	// 消息正文为信封时解析出的信封，MessageBody 为信封中的正文
+	Envelope *Envelope `xml:"-"`
+
+	client    *Message
+	queuename string
+}
+
+// SendMessage 返回的结果
+type SendResult struct {
+	XMLName        xml.Name `xml:"Message"`
+	MessageId      string   `xml:"MessageId"`
+	MessageBodyMD5 string   `xml:"MessageBodyMD5"`
+}
+
+// ChangeMessageVisibility 返回的结果
+type ChangeVisibility struct {
+	XMLName         xml.Name `xml:"ChangeVisibility"`
+	ReceiptHandle   string   `xml:"ReceiptHandle"`
+	NextVisibleTime int64    `xml:"NextVisibleTime"`
+}
+
+// GetQueueAttributes 返回的队列属性
+type QueueAttributes struct {
+	XMLName                xml.Name `xml:"Queue"`
+	QueueName              string   `xml:"QueueName"`
+	CreateTime             int64    `xml:"CreateTime"`
+	LastModifyTime         int64    `xml:"LastModifyTime"`
+	DelaySeconds           int      `xml:"DelaySeconds"`
+	MaximumMessageSize     int      `xml:"MaximumMessageSize"`
+	MessageRetentionPeriod int      `xml:"MessageRetentionPeriod"`
+	VisibilityTimeout      int      `xml:"VisibilityTimeout"`
+	PollingWaitSeconds     int      `xml:"PollingWaitSeconds"`
+	ActiveMessages         int      `xml:"ActiveMessages"`
+	InactiveMessages       int      `xml:"InactiveMessages"`
+	DelayMessages          int      `xml:"DelayMessages"`
+}
+
+// @Title 解析 GetQueueAttributes 返回的xml
+// @Param content 返回内容
+func ParseQueueAttributes(content string) (*QueueAttributes, error) {
+	attrs := &QueueAttributes{}
+	if err := xml.Unmarshal([]byte(content), attrs); err != nil {
+		return nil, err
+	}
+	return attrs, nil
+}
+
+// ListQueue 返回的一页队列
+type QueueList struct {
+	XMLName    xml.Name     `xml:"Queues"`
+	Queues     []*QueueInfo `xml:"Queue"`
+	NextMarker string       `xml:"NextMarker"`
+}
+
+// 队列列表中的一个队列
+type QueueInfo struct {
+	URL  string `xml:"QueueURL"`
+	Name string `xml:"-"`
+}
+
+// @Title 解析 ListQueue 返回的xml，并从 QueueURL 中取出队列名称
+// @Param content 返回内容
+func ParseQueueList(content string) (*QueueList, error) {
+	list := &QueueList{}
+	if err := xml.Unmarshal([]byte(content), list); err != nil {
+		return nil, err
+	}
+	for _, q := range list.Queues {
+		q.Name = q.URL[strings.LastIndex(q.URL, "/")+1:]
+	}
+	return list, nil
+}
+
+// @Title 解析 ReceiveMessage/PeekMessage 返回的xml
+// @Param content 返回内容
+func ParseReceivedMessage(content string) (*ReceivedMessage, error) {
+	msg := &ReceivedMessage{}
+	if err := xml.Unmarshal([]byte(content), msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// @Title 解析 SendMessage 返回的xml
+// @Param content 返回内容
+func ParseSendResult(content string) (*SendResult, error) {
+	result := &SendResult{}
+	if err := xml.Unmarshal([]byte(content), result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// @Title 解析 ChangeMessageVisibility 返回的xml
+// @Param content 返回内容
+func ParseChangeVisibility(content string) (*ChangeVisibility, error) {
+	result := &ChangeVisibility{}
+	if err := xml.Unmarshal([]byte(content), result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// @Title 获取信封头信息，消息不是信封时返回空字符串
+func (this *ReceivedMessage) Header(name string) string {
+	if this.Envelope == nil {
+		return ""
+	}
+	return this.Envelope.Get(name)
+}
+
+// @Title 获取最初发送时的 MessageId，消息被重新投递过时与 MessageId 不同
+func (this *ReceivedMessage) OriginMessageId() string {
+	if id := this.Header(HeaderOriginMessageId); id != "" {
+		return id
+	}
+	return this.MessageId
+}
+
+// 用消息正文和信封头(不含签名)生成新的信封，用于转发消息
+func (this *ReceivedMessage) forwardEnvelope() *Envelope {
+	env := NewEnvelope(this.MessageBody)
+	if this.Envelope != nil {
+		for _, h := range this.Envelope.Headers {
+			if h.Name != HeaderSignKeyId && h.Name != HeaderSignSignature {
+				env.Set(h.Name, h.Value)
+			}
+		}
+	}
+	return env
+}
+
+func (this *ReceivedMessage) toXml() (string, error) {
+	output, err := xml.Marshal(this)
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
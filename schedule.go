@@ -0,0 +1,67 @@
+package aliyunMQS
+
+import (
+	"math"
+	"strconv"
+	"time"
+)
+
+// 定时消息的投递时间，毫秒时间戳
+const HeaderScheduleAt = "x-schedule-at"
+
+// @Title 发送定时消息，超过 DelaySeconds 上限(4天)的消息在到期前由消费者重新延迟投递
+// @Param queuename 	队列名称
+// @Param messagebody 	消息正文
+// @Param at 			投递时间
+// @Param param 		参数，同 SendMessage，DelaySeconds 会被忽略
+func (this *Message) ScheduleAt(queuename, messagebody string, at time.Time, param map[string]int) (string, error) {
+	env := NewEnvelope(messagebody)
+	env.Set(HeaderScheduleAt, strconv.FormatInt(at.UnixNano()/1e6, 10))
+	return this.sendScheduled(queuename, env, at, param)
+}
+
+// @Title 消息是否还未到投递时间，未到时重新延迟投递并从队列删除
+// @Param queuename 	队列名称
+// @Param msg 			通过 Receive 获得的消息
+func (this *Message) Reschedule(queuename string, msg *ReceivedMessage) (bool, error) {
+	at, ok := scheduledAt(msg)
+	if !ok || time.Until(at) < time.Second {
+		return false, nil
+	}
+	env := msg.forwardEnvelope()
+	env.Set(HeaderOriginMessageId, msg.OriginMessageId())
+	param := map[string]int{}
+	if msg.Priority > 0 {
+		param["Priority"] = msg.Priority
+	}
+	if _, err := this.sendScheduled(queuename, env, at, param); err != nil {
+		return true, err
+	}
+	_, err := this.DeleteMessage(queuename, msg.ReceiptHandle)
+	return true, err
+}
+
+func (this *Message) sendScheduled(queuename string, env *Envelope, at time.Time, param map[string]int) (string, error) {
+	delay := int(math.Ceil(time.Until(at).Seconds()))
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > maxDelaySeconds {
+		delay = maxDelaySeconds
+	}
+	_param := map[string]int{}
+	for k, v := range param {
+		_param[k] = v
+	}
+	_param["DelaySeconds"] = delay
+	return this.SendEnvelope(queuename, env, _param)
+}
+
+// 消息的投递时间
+func scheduledAt(msg *ReceivedMessage) (time.Time, bool) {
+	ms, err := strconv.ParseInt(msg.Header(HeaderScheduleAt), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, ms*int64(time.Millisecond)), true
+}
@@ -0,0 +1,56 @@
+package aliyunMQS
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSchedule(t *testing.T) {
+	Convey("定时消息测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		queue.CreateQueue("reminders", nil)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+
+		delivered := []string{}
+		consumer := NewConsumer(&msg, "reminders", func(m *ReceivedMessage) error {
+			delivered = append(delivered, m.MessageBody)
+			return nil
+		})
+
+		Convey("超过4天的消息提前出现时重新延迟", func() {
+			_, err := msg.ScheduleAt("reminders", "in 10 days", time.Now().Add(10*24*time.Hour), map[string]int{"Priority": 2})
+			So(err, ShouldBeNil)
+			_, err = msg.Receive("reminders", 0)
+			So(IsMessageNotExist(err), ShouldBeTrue)
+
+			mock.expire("reminders")
+			m, err := msg.Receive("reminders", 0)
+			So(err, ShouldBeNil)
+			So(consumer.Process(m), ShouldBeNil)
+			So(delivered, ShouldBeEmpty)
+			So(mock.count("reminders"), ShouldEqual, 1)
+
+			mock.expire("reminders")
+			m, err = msg.Receive("reminders", 0)
+			So(err, ShouldBeNil)
+			So(m.Priority, ShouldEqual, 2)
+			So(m.DequeueCount, ShouldEqual, 1)
+		})
+
+		Convey("到期的消息交给Handler", func() {
+			_, err := msg.ScheduleAt("reminders", "now", time.Now(), nil)
+			So(err, ShouldBeNil)
+			m, err := msg.Receive("reminders", 0)
+			So(err, ShouldBeNil)
+			So(consumer.Process(m), ShouldBeNil)
+			So(delivered, ShouldResemble, []string{"now"})
+			So(mock.count("reminders"), ShouldEqual, 0)
+		})
+	})
+}
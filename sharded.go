@@ -0,0 +1,147 @@
+package aliyunMQS
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// 分片消息的放置方式
+type Placement int
+
+const (
+	// 轮流发送到各个分片
+	PlacementRoundRobin Placement = iota
+	// 按键散列到固定分片
+	PlacementHash
+)
+
+// 分片队列，把消息分散到N个物理队列以提高吞吐量，消费时公平地轮询所有分片
+type ShardedQueue struct {
+	Queue   *Queue
+	Message *Message
+	// 逻辑队列名称，物理队列为 Name-s0 ~ Name-s(N-1)
+	Name      string
+	Shards    int
+	Placement Placement
+	// 消费时并发处理的协程数
+	Workers int
+	// 所有分片都没有消息时长轮询的等待时间,单位为秒
+	WaitSeconds int
+
+	next uint32
+}
+
+// 分片队列的统计
+type ShardStats struct {
+	Shards           []*QueueAttributes
+	ActiveMessages   int
+	InactiveMessages int
+	DelayMessages    int
+}
+
+// @Title 创建分片队列
+// @Param queue 	队列客户端
+// @Param msg 		消息客户端
+// @Param name 		逻辑队列名称
+// @Param shards 	分片数，小于1时按1处理
+func NewShardedQueue(queue *Queue, msg *Message, name string, shards int) *ShardedQueue {
+	if shards < 1 {
+		shards = 1
+	}
+	return &ShardedQueue{Queue: queue, Message: msg, Name: name, Shards: shards, Workers: 1, WaitSeconds: 10}
+}
+
+// @Title 第i个分片的物理队列名称
+func (this *ShardedQueue) ShardName(i int) string {
+	return fmt.Sprintf("%s-s%d", this.Name, i)
+}
+
+// @Title 创建所有分片
+// @Param param 队列参数，同 CreateQueue
+func (this *ShardedQueue) Create(param map[string]int) error {
+	for i := 0; i < this.Shards; i++ {
+		if _, err := this.Queue.CreateQueue(this.ShardName(i), param); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// @Title 修改所有分片的属性
+// @Param param 队列参数，同 SetQueueAttributes
+func (this *ShardedQueue) SetAttributes(param map[string]int) error {
+	for i := 0; i < this.Shards; i++ {
+		if _, err := this.Queue.SetQueueAttributes(this.ShardName(i), param); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// @Title 获取所有分片的属性和消息数合计
+func (this *ShardedQueue) Stats() (*ShardStats, error) {
+	stats := &ShardStats{}
+	for i := 0; i < this.Shards; i++ {
+		attrs, err := this.Queue.Attributes(this.ShardName(i))
+		if err != nil {
+			return nil, err
+		}
+		stats.Shards = append(stats.Shards, attrs)
+		stats.ActiveMessages += attrs.ActiveMessages
+		stats.InactiveMessages += attrs.InactiveMessages
+		stats.DelayMessages += attrs.DelayMessages
+	}
+	return stats, nil
+}
+
+// @Title 删除所有分片
+func (this *ShardedQueue) Delete() error {
+	for i := 0; i < this.Shards; i++ {
+		if _, err := this.Queue.DeleteQueue(this.ShardName(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// @Title 发送消息，PlacementHash 时按key选择分片，否则轮流发送
+// @Param key 			放置键，PlacementRoundRobin 时忽略
+// @Param messagebody 	消息正文
+// @Param param 		参数，同 SendMessage
+func (this *ShardedQueue) SendMessage(key, messagebody string, param map[string]int) (string, error) {
+	if this.Shards < 1 {
+		return "", fmt.Errorf("%w: 分片数为 %d，必须大于0", ErrInvalidParam, this.Shards)
+	}
+	var shard int
+	if this.Placement == PlacementHash {
+		shard = partitionOf(key, this.Shards)
+	} else {
+		shard = int((atomic.AddUint32(&this.next, 1) - 1) % uint32(this.Shards))
+	}
+	return this.Message.SendMessage(this.ShardName(shard), messagebody, param)
+}
+
+// @Title 为每个分片创建消费者，可以在 Run 之前修改死信、退避等配置
+// @Param handler 消息处理函数
+func (this *ShardedQueue) Consumers(handler Handler) []*Consumer {
+	if this.Shards < 1 {
+		return nil
+	}
+	consumers := make([]*Consumer, this.Shards)
+	for i := range consumers {
+		consumers[i] = NewConsumer(this.Message, this.ShardName(i), handler)
+	}
+	return consumers
+}
+
+// @Title 公平地轮询所有分片并处理消息，直到ctx被取消
+// @Param consumers 由 Consumers 创建的消费者
+func (this *ShardedQueue) Run(ctx context.Context, consumers []*Consumer) error {
+	multi := NewMultiConsumer(this.Workers)
+	multi.WaitSeconds = this.WaitSeconds
+	for _, c := range consumers {
+		multi.Add(c, 1)
+	}
+	return multi.Run(ctx)
+}
@@ -0,0 +1,88 @@
+package aliyunMQS
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestShardedQueue(t *testing.T) {
+	Convey("分片队列测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+		sharded := NewShardedQueue(&queue, &msg, "bulk", 3)
+		So(sharded.Create(map[string]int{"VisibilityTimeout": 60}), ShouldBeNil)
+
+		Convey("轮流发送到各个分片", func() {
+			for i := 0; i < 6; i++ {
+				_, err := sharded.SendMessage("", fmt.Sprintf("m%d", i), nil)
+				So(err, ShouldBeNil)
+			}
+			for i := 0; i < 3; i++ {
+				So(mock.count(sharded.ShardName(i)), ShouldEqual, 2)
+			}
+			stats, err := sharded.Stats()
+			So(err, ShouldBeNil)
+			So(stats.ActiveMessages, ShouldEqual, 6)
+			So(stats.Shards[0].VisibilityTimeout, ShouldEqual, 60)
+		})
+
+		Convey("分片数小于1时不会panic", func() {
+			So(NewShardedQueue(&queue, &msg, "bulk", 0).Shards, ShouldEqual, 1)
+			sharded.Shards = 0
+			_, err := sharded.SendMessage("", "m", nil)
+			So(errors.Is(err, ErrInvalidParam), ShouldBeTrue)
+			sharded.Placement = PlacementHash
+			_, err = sharded.SendMessage("k", "m", nil)
+			So(errors.Is(err, ErrInvalidParam), ShouldBeTrue)
+			So(sharded.Consumers(nil), ShouldBeEmpty)
+		})
+
+		Convey("按键散列到固定分片", func() {
+			sharded.Placement = PlacementHash
+			for i := 0; i < 4; i++ {
+				sharded.SendMessage("tenant-1", "m", nil)
+			}
+			So(mock.count(sharded.ShardName(partitionOf("tenant-1", 3))), ShouldEqual, 4)
+		})
+
+		Convey("公平地消费所有分片", func() {
+			for i := 0; i < 9; i++ {
+				sharded.SendMessage("", fmt.Sprintf("m%d", i), nil)
+			}
+			var lock sync.Mutex
+			got := []string{}
+			ctx, cancel := context.WithCancel(context.Background())
+			sharded.Workers = 2
+			sharded.WaitSeconds = 0
+			err := sharded.Run(ctx, sharded.Consumers(func(m *ReceivedMessage) error {
+				lock.Lock()
+				defer lock.Unlock()
+				got = append(got, m.MessageBody)
+				if len(got) == 9 {
+					cancel()
+				}
+				return nil
+			}))
+			So(err, ShouldEqual, context.Canceled)
+			So(len(got), ShouldEqual, 9)
+			for i := 0; i < 3; i++ {
+				So(mock.count(sharded.ShardName(i)), ShouldEqual, 0)
+			}
+		})
+
+		Convey("删除所有分片", func() {
+			So(sharded.Delete(), ShouldBeNil)
+			_, err := sharded.Stats()
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,139 @@
+package aliyunMQS
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// 信封中签名使用的头信息名称
+const (
+	HeaderSignKeyId     = "x-sign-key-id"
+	HeaderSignSignature = "x-sign-signature"
+)
+
+// 未签名或签名错误的消息的处理策略
+type SignPolicy int
+
+const (
+	// 默认策略：不删除消息，返回错误，消息在 VisibilityTimeout 后重新可见。
+	// 共享队列中其他生产者的未签名消息不会被误删
+	SignPolicyLeave SignPolicy = iota
+	// 拒绝消息，从队列中删除并返回错误
+	SignPolicyReject
+	// 转发到 DeadLetterQueue 后从队列中删除，并返回错误
+	SignPolicyDeadLetter
+	// 只记录日志，消息照常返回
+	SignPolicyLog
+)
+
+var ErrInvalidSignature = errors.New("消息签名校验失败")
+
+// 消息签名，发送时用 HMAC-SHA256 对信封签名，接收时校验
+type Signer struct {
+	// 签名使用的key id
+	KeyId string
+	// key id 对应的密钥，校验时按信封中的key id查找
+	Keys map[string]string
+	// 校验失败时的处理策略
+	Policy SignPolicy
+	// Policy 为 SignPolicyDeadLetter 时转发的队列
+	DeadLetterQueue string
+}
+
+// @Title 创建一个签名器
+// @Param keyid 	签名使用的key id
+// @Param secret 	密钥
+func NewSigner(keyid, secret string) *Signer {
+	return &Signer{KeyId: keyid, Keys: map[string]string{keyid: secret}}
+}
+
+// @Title 检查配置，SignPolicyDeadLetter 必须指定 DeadLetterQueue
+func (this *Signer) Validate() error {
+	if this.Policy == SignPolicyDeadLetter && this.DeadLetterQueue == "" {
+		return errors.New("签名策略为 SignPolicyDeadLetter 时必须指定 DeadLetterQueue")
+	}
+	return nil
+}
+
+// @Title 对信封签名
+// @Param env 信封
+func (this *Signer) Sign(env *Envelope) error {
+	secret, ok := this.Keys[this.KeyId]
+	if !ok {
+		return errors.New("未找到签名密钥:" + this.KeyId)
+	}
+	env.Del(HeaderSignSignature)
+	env.Set(HeaderSignKeyId, this.KeyId)
+	env.Set(HeaderSignSignature, this.getSignature(secret, env))
+	return nil
+}
+
+// @Title 校验信封签名
+// @Param env 信封，为nil表示消息未签名
+func (this *Signer) Verify(env *Envelope) error {
+	if env == nil || env.Get(HeaderSignSignature) == "" {
+		return fmt.Errorf("%w: 消息未签名", ErrInvalidSignature)
+	}
+	keyid := env.Get(HeaderSignKeyId)
+	secret, ok := this.Keys[keyid]
+	if !ok {
+		return fmt.Errorf("%w: 未知的key id %s", ErrInvalidSignature, keyid)
+	}
+	if !hmac.Equal([]byte(env.Get(HeaderSignSignature)), []byte(this.getSignature(secret, env))) {
+		return fmt.Errorf("%w: 签名不匹配", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// 待签名字符串为排序后的信封头(不含签名本身)加正文，同 MQS.getSignature
+func (this *Signer) getSignature(secret string, env *Envelope) string {
+	headers := map[string]string{}
+	keys := []string{}
+	for _, h := range env.Headers {
+		if h.Name == HeaderSignSignature {
+			continue
+		}
+		headers[strings.ToLower(h.Name)] = h.Value
+		keys = append(keys, strings.ToLower(h.Name))
+	}
+	sort.Strings(keys)
+	headers_string := ""
+	for _, v := range keys {
+		headers_string = fmt.Sprintf("%s%s:%s\n", headers_string, v, headers[v])
+	}
+	string2sign := fmt.Sprintf("%s\n%s%s", env.Version, headers_string, env.Body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(string2sign))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 按策略处理签名校验失败的消息
+func (this *Message) rejectUnsigned(queuename string, msg *ReceivedMessage, verr error) error {
+	switch this.Signer.Policy {
+	case SignPolicyLog:
+		log.Printf("队列%s消息%s %v", queuename, msg.MessageId, verr)
+		return nil
+	case SignPolicyDeadLetter:
+		if msg.ReceiptHandle == "" {
+			return verr
+		}
+		if err := this.deadLetter(queuename, msg, this.Signer.DeadLetterQueue, verr.Error(), false); err != nil {
+			return err
+		}
+		return verr
+	case SignPolicyLeave:
+		return verr
+	}
+	if msg.ReceiptHandle != "" {
+		if _, err := this.DeleteMessage(queuename, msg.ReceiptHandle); err != nil {
+			return err
+		}
+	}
+	return verr
+}
@@ -0,0 +1,113 @@
+package aliyunMQS
+
+import (
+	"errors"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSigner(t *testing.T) {
+	Convey("消息签名测试", t, func() {
+		signer := NewSigner("p1", "secret")
+
+		Convey("签名后校验通过", func() {
+			env := NewEnvelope("hello")
+			So(signer.Sign(env), ShouldBeNil)
+			So(env.Get(HeaderSignKeyId), ShouldEqual, "p1")
+			So(signer.Verify(env), ShouldBeNil)
+		})
+
+		Convey("篡改正文或头信息校验失败", func() {
+			env := NewEnvelope("hello")
+			So(signer.Sign(env), ShouldBeNil)
+			env.Body = "hello!"
+			So(errors.Is(signer.Verify(env), ErrInvalidSignature), ShouldBeTrue)
+
+			env = NewEnvelope("hello")
+			So(signer.Sign(env), ShouldBeNil)
+			env.Set("x-extra", "1")
+			So(signer.Verify(env), ShouldNotBeNil)
+		})
+
+		Convey("未签名或未知key id校验失败", func() {
+			So(signer.Verify(nil), ShouldNotBeNil)
+			env := NewEnvelope("hello")
+			So(NewSigner("p2", "secret").Sign(env), ShouldBeNil)
+			So(signer.Verify(env), ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSignedMessage(t *testing.T) {
+	Convey("签名消息收发测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		queue.CreateQueue("shared", nil)
+		queue.CreateQueue("shared-dlq", nil)
+
+		var producer Message
+		mock.NewMQS(&producer.MQS)
+		producer.Signer = NewSigner("p1", "secret")
+		var untrusted Message
+		mock.NewMQS(&untrusted.MQS)
+
+		var consumer Message
+		mock.NewMQS(&consumer.MQS)
+		consumer.Signer = NewSigner("p1", "secret")
+
+		Convey("可信消息正常接收", func() {
+			_, err := producer.SendMessage("shared", "trusted", nil)
+			So(err, ShouldBeNil)
+			received, err := consumer.Receive("shared", 0)
+			So(err, ShouldBeNil)
+			So(received.MessageBody, ShouldEqual, "trusted")
+		})
+
+		Convey("默认策略不删除未签名消息", func() {
+			untrusted.SendMessage("shared", "other", nil)
+			_, err := consumer.Receive("shared", 0)
+			So(errors.Is(err, ErrInvalidSignature), ShouldBeTrue)
+			So(mock.count("shared"), ShouldEqual, 1)
+		})
+
+		Convey("拒绝策略删除未签名消息", func() {
+			consumer.Signer.Policy = SignPolicyReject
+			untrusted.SendMessage("shared", "forged", nil)
+			_, err := consumer.Receive("shared", 0)
+			So(errors.Is(err, ErrInvalidSignature), ShouldBeTrue)
+			So(mock.count("shared"), ShouldEqual, 0)
+		})
+
+		Convey("死信策略未指定队列时不接收", func() {
+			consumer.Signer.Policy = SignPolicyDeadLetter
+			untrusted.SendMessage("shared", "forged", nil)
+			_, err := consumer.Receive("shared", 0)
+			So(err, ShouldNotBeNil)
+			So(errors.Is(err, ErrInvalidSignature), ShouldBeFalse)
+			_, err = consumer.ReceiveMessage("shared", 0)
+			So(err, ShouldNotBeNil)
+			So(mock.queues["shared"].messages[0].dequeueCount, ShouldEqual, 0)
+		})
+
+		Convey("死信策略转发未签名消息", func() {
+			consumer.Signer.Policy = SignPolicyDeadLetter
+			consumer.Signer.DeadLetterQueue = "shared-dlq"
+			untrusted.SendMessage("shared", "forged", nil)
+			_, err := consumer.Receive("shared", 0)
+			So(err, ShouldNotBeNil)
+			So(mock.count("shared"), ShouldEqual, 0)
+			So(mock.count("shared-dlq"), ShouldEqual, 1)
+		})
+
+		Convey("日志策略照常返回", func() {
+			consumer.Signer.Policy = SignPolicyLog
+			untrusted.SendMessage("shared", "forged", nil)
+			received, err := consumer.Receive("shared", 0)
+			So(err, ShouldBeNil)
+			So(received.MessageBody, ShouldEqual, "forged")
+		})
+	})
+}
@@ -0,0 +1,589 @@
+package aliyunMQS
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 写入spool后刷盘的策略
+type SyncPolicy int
+
+const (
+	// 每条消息写入后立即刷盘
+	SyncAlways SyncPolicy = iota
+	// 距上次刷盘超过 SyncInterval 时刷盘
+	SyncInterval
+	// 由操作系统决定
+	SyncNever
+)
+
+var ErrSpoolFull = errors.New("spool已满")
+
+// spool队首的消息发送时遇到不可重试的错误，记录保留在队首，确认后可以调用 Reject 移走
+var ErrSpoolRejected = errors.New("spool中的消息被拒绝")
+
+// spool中一条记录的头部：4字节长度 + 4字节crc32，crc32覆盖长度和内容
+const spoolHeaderSize = 8
+
+// 一条记录内容的最大长度。消息正文最大64KB，XML转义后最多膨胀约6倍
+const maxSpoolRecordSize = 1 << 20
+
+// 生产端本地预写日志。SendMessage 遇到可重试的错误时把消息追加到分段文件中，
+// 由 Run 在服务恢复后按顺序重新发送。spool中还有消息时新消息也写入spool，保证顺序
+type Spool struct {
+	Dir     string
+	Message *Message
+	// 单个分段文件的最大字节数
+	SegmentSize int64
+	// spool中未发送消息的最大字节数，0表示不限
+	MaxSize int64
+	// 刷盘策略
+	Sync         SyncPolicy
+	SyncInterval time.Duration
+	// 发送失败后等待多久重试
+	RetryInterval time.Duration
+
+	lock     sync.Mutex
+	segments []int64
+	writer   *os.File
+	writeOff int64
+	lastSync time.Time
+	readSeg  int64
+	readOff  int64
+	size     int64
+	kick     chan struct{}
+}
+
+type spoolRecord struct {
+	XMLName     xml.Name     `xml:"Record"`
+	QueueName   string       `xml:"QueueName"`
+	MessageBody string       `xml:"MessageBody"`
+	Params      []spoolParam `xml:"Param"`
+}
+
+type spoolParam struct {
+	Name  string `xml:"Name,attr"`
+	Value int    `xml:"Value,attr"`
+}
+
+// @Title 打开spool目录，目录不存在时创建
+// @Param dir 	目录
+// @Param msg 	消息客户端
+func OpenSpool(dir string, msg *Message) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	this := &Spool{
+		Dir:           dir,
+		Message:       msg,
+		SegmentSize:   64 << 20,
+		Sync:          SyncAlways,
+		SyncInterval:  time.Second,
+		RetryInterval: 5 * time.Second,
+		kick:          make(chan struct{}, 1),
+	}
+	if err := this.load(); err != nil {
+		return nil, err
+	}
+	return this, nil
+}
+
+// @Title 发送消息，遇到可重试的错误时写入spool并返回空字符串
+// @Param queuename 	队列名称
+// @Param messagebody 	消息正文
+// @Param param 		参数，同 SendMessage
+func (this *Spool) SendMessage(queuename, messagebody string, param map[string]int) (string, error) {
+	// 参数错误重试也不会成功，不写入spool
+	if err := validateParam(param, messageParams); err != nil {
+		return "参数错误", err
+	}
+	// 先按配置加密、签名，spool中不保存明文
+	encoded, err := this.Message.encodeMessage(messagebody)
+	if err != nil {
+		return "封装消息失败", err
+	}
+	this.lock.Lock()
+	pending := this.size > 0
+	this.lock.Unlock()
+	if !pending {
+		content, err := this.Message.sendMessage(queuename, encoded, param)
+		if err == nil || !IsRetryable(err) {
+			return content, err
+		}
+	}
+	record := &spoolRecord{QueueName: queuename, MessageBody: encoded}
+	for k, v := range param {
+		record.Params = append(record.Params, spoolParam{Name: k, Value: v})
+	}
+	if err := this.append(record); err != nil {
+		return "写入spool失败", err
+	}
+	return "", nil
+}
+
+// @Title spool中未发送消息的字节数
+func (this *Spool) Size() int64 {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	return this.size
+}
+
+// @Title 持续重新发送spool中的消息，直到ctx被取消
+func (this *Spool) Run(ctx context.Context) error {
+	for {
+		wait := this.RetryInterval
+		if _, err := this.Drain(); err != nil {
+			log.Printf("spool %s 发送失败: %v", this.Dir, err)
+		} else {
+			wait = time.Minute
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-this.kick:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// @Title 按顺序发送spool中的消息，出错时停止并把记录留在队首，返回发送的条数。
+// 不可重试的错误(如签名错误、队列不存在)返回 ErrSpoolRejected，需要人工处理
+func (this *Spool) Drain() (int, error) {
+	n := 0
+	for {
+		record, next, err := this.peek()
+		if err != nil || record == nil {
+			return n, err
+		}
+		param := map[string]int{}
+		for _, p := range record.Params {
+			param[p.Name] = p.Value
+		}
+		if _, err := this.Message.sendMessage(record.QueueName, record.MessageBody, param); err != nil {
+			if IsRetryable(err) {
+				return n, err
+			}
+			return n, fmt.Errorf("%w: 队列%s: %w", ErrSpoolRejected, record.QueueName, err)
+		}
+		n++
+		if err := this.advance(next); err != nil {
+			return n, err
+		}
+	}
+}
+
+// @Title 把队首的记录移到 rejected 文件，用于处理 Drain 返回 ErrSpoolRejected 的消息
+func (this *Spool) Reject() error {
+	record, next, err := this.peek()
+	if err != nil || record == nil {
+		return err
+	}
+	frame, err := encodeSpoolRecord(record)
+	if err != nil {
+		return err
+	}
+	if err := this.setAside("rejected", frame); err != nil {
+		return err
+	}
+	return this.advance(next)
+}
+
+// @Title 刷盘并关闭spool
+func (this *Spool) Close() error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.writer == nil {
+		return nil
+	}
+	this.writer.Sync()
+	err := this.writer.Close()
+	this.writer = nil
+	return err
+}
+
+func (this *Spool) segmentPath(id int64) string {
+	return filepath.Join(this.Dir, fmt.Sprintf("%016d.seg", id))
+}
+
+// 追加到不再发送的记录文件中，格式与分段文件相同
+func (this *Spool) setAside(name string, frame []byte) error {
+	f, err := os.OpenFile(filepath.Join(this.Dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(frame); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (this *Spool) cursorPath() string {
+	return filepath.Join(this.Dir, "cursor")
+}
+
+// 加载分段文件和读取位置，截掉最后一个分段中写了一半的记录
+func (this *Spool) load() error {
+	names, err := filepath.Glob(filepath.Join(this.Dir, "*.seg"))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		id, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(name), ".seg"), 10, 64)
+		if err == nil {
+			this.segments = append(this.segments, id)
+		}
+	}
+	sort.Slice(this.segments, func(i, j int) bool { return this.segments[i] < this.segments[j] })
+
+	if content, err := ioutil.ReadFile(this.cursorPath()); err == nil {
+		fmt.Sscanf(string(content), "%d %d", &this.readSeg, &this.readOff)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	// 删除已经发送完的分段
+	for len(this.segments) > 0 && this.segments[0] < this.readSeg {
+		os.Remove(this.segmentPath(this.segments[0]))
+		this.segments = this.segments[1:]
+	}
+	if len(this.segments) == 0 {
+		this.segments = []int64{this.readSeg}
+		this.readOff = 0
+	} else if this.segments[0] > this.readSeg {
+		this.readSeg, this.readOff = this.segments[0], 0
+	}
+
+	last := this.segments[len(this.segments)-1]
+	valid, err := this.validLength(last)
+	if err != nil {
+		return err
+	}
+	this.writer, err = os.OpenFile(this.segmentPath(last), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	if err := this.writer.Truncate(valid); err != nil {
+		return err
+	}
+	if _, err := this.writer.Seek(valid, io.SeekStart); err != nil {
+		return err
+	}
+	this.writeOff = valid
+
+	for _, id := range this.segments {
+		size := valid
+		if id != last {
+			info, err := os.Stat(this.segmentPath(id))
+			if err != nil {
+				return err
+			}
+			size = info.Size()
+		}
+		if id == this.readSeg {
+			size -= this.readOff
+		}
+		this.size += size
+	}
+	return nil
+}
+
+// 分段文件中完整记录的长度
+func (this *Spool) validLength(id int64) (int64, error) {
+	f, err := os.Open(this.segmentPath(id))
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		_, n, err := readSpoolRecord(r)
+		if err == io.EOF {
+			return offset, nil
+		}
+		var corrupt *spoolCorrupt
+		if err == nil || (errors.As(err, &corrupt) && n > 0) {
+			// 内容无法解析的完整记录保留，读取时隔离
+			offset += n
+			continue
+		}
+		if err != io.ErrUnexpectedEOF && corrupt == nil {
+			return 0, err
+		}
+		// 长度不可信，向后查找下一条完整的记录
+		rest, err := readSpoolFrom(f, offset)
+		if err != nil {
+			return 0, err
+		}
+		skip := resyncSpool(rest)
+		if skip < 0 {
+			if corrupt == nil {
+				// 最后一条记录写了一半
+				return offset, nil
+			}
+			// 损坏的记录保留，读取时隔离
+			return offset + int64(len(rest)), nil
+		}
+		offset += skip
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		r.Reset(f)
+	}
+}
+
+// 读取分段文件从offset开始的内容
+func readSpoolFrom(f *os.File, offset int64) ([]byte, error) {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(f)
+}
+
+// 从损坏的位置之后查找下一条校验通过的记录，返回损坏部分的长度，找不到时返回-1
+func resyncSpool(data []byte) int64 {
+	for i := 1; i+spoolHeaderSize <= len(data); i++ {
+		length := binary.BigEndian.Uint32(data[i:])
+		end := i + spoolHeaderSize + int(length)
+		if length > maxSpoolRecordSize || end > len(data) {
+			continue
+		}
+		if spoolChecksum(data[i:i+4], data[i+spoolHeaderSize:end]) == binary.BigEndian.Uint32(data[i+4:]) {
+			return int64(i)
+		}
+	}
+	return -1
+}
+
+func spoolChecksum(length, payload []byte) uint32 {
+	return crc32.Update(crc32.ChecksumIEEE(length), crc32.IEEETable, payload)
+}
+
+func encodeSpoolRecord(record *spoolRecord) ([]byte, error) {
+	payload, err := xml.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > maxSpoolRecordSize {
+		return nil, fmt.Errorf("spool记录长度%d超出上限%d", len(payload), maxSpoolRecordSize)
+	}
+	header := make([]byte, spoolHeaderSize)
+	binary.BigEndian.PutUint32(header, uint32(len(payload)))
+	binary.BigEndian.PutUint32(header[4:], spoolChecksum(header[:4], payload))
+	return append(header, payload...), nil
+}
+
+func (this *Spool) append(record *spoolRecord) error {
+	frame, err := encodeSpoolRecord(record)
+	if err != nil {
+		return err
+	}
+	n := int64(len(frame))
+
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	if this.writer == nil {
+		return errors.New("spool已关闭")
+	}
+	if this.MaxSize > 0 && this.size+n > this.MaxSize {
+		return ErrSpoolFull
+	}
+	if this.writeOff > 0 && this.writeOff+n > this.SegmentSize {
+		if err := this.roll(); err != nil {
+			return err
+		}
+	}
+	if _, err := this.writer.Write(frame); err != nil {
+		return err
+	}
+	this.writeOff += n
+	this.size += n
+	if this.Sync == SyncAlways || (this.Sync == SyncInterval && time.Since(this.lastSync) >= this.SyncInterval) {
+		if err := this.writer.Sync(); err != nil {
+			return err
+		}
+		this.lastSync = time.Now()
+	}
+	select {
+	case this.kick <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// 关闭当前分段，开始写新的分段
+func (this *Spool) roll() error {
+	if err := this.writer.Sync(); err != nil {
+		return err
+	}
+	if err := this.writer.Close(); err != nil {
+		return err
+	}
+	id := this.segments[len(this.segments)-1] + 1
+	writer, err := os.OpenFile(this.segmentPath(id), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	this.writer = writer
+	this.writeOff = 0
+	this.segments = append(this.segments, id)
+	return nil
+}
+
+// spool中的读取位置
+type spoolCursor struct {
+	seg int64
+	off int64
+	n   int64
+}
+
+// 读取下一条待发送的记录，没有时返回nil
+func (this *Spool) peek() (*spoolRecord, *spoolCursor, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	for {
+		if this.size == 0 {
+			return nil, nil, nil
+		}
+		last := this.segments[len(this.segments)-1]
+		f, err := os.Open(this.segmentPath(this.readSeg))
+		if err != nil {
+			return nil, nil, err
+		}
+		f.Seek(this.readOff, io.SeekStart)
+		record, n, err := readSpoolRecord(bufio.NewReader(f))
+		if err == nil {
+			f.Close()
+			return record, &spoolCursor{seg: this.readSeg, off: this.readOff + n, n: n}, nil
+		}
+		var corrupt *spoolCorrupt
+		if errors.As(err, &corrupt) || err == io.ErrUnexpectedEOF {
+			var frame []byte
+			if corrupt != nil && n > 0 {
+				frame = corrupt.frame
+			} else {
+				// 长度不可信，隔离到下一条完整的记录为止
+				rest, rerr := readSpoolFrom(f, this.readOff)
+				if rerr != nil {
+					f.Close()
+					return nil, nil, rerr
+				}
+				n = resyncSpool(rest)
+				if n < 0 {
+					n = int64(len(rest))
+				}
+				frame = rest[:n]
+			}
+			f.Close()
+			log.Printf("spool %s 隔离第%d个分段偏移%d处损坏的%d字节: %v", this.Dir, this.readSeg, this.readOff, n, err)
+			if err := this.setAside("quarantine", frame); err != nil {
+				return nil, nil, err
+			}
+			this.readOff += n
+			this.size -= n
+			if err := this.saveCursor(); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		f.Close()
+		if err != io.EOF || this.readSeg == last {
+			return nil, nil, err
+		}
+		// 当前分段已读完，删除后读下一个分段
+		os.Remove(this.segmentPath(this.readSeg))
+		this.segments = this.segments[1:]
+		this.readSeg, this.readOff = this.segments[0], 0
+		if err := this.saveCursor(); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// 记录已发送，移动读取位置
+func (this *Spool) advance(next *spoolCursor) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	this.readSeg, this.readOff = next.seg, next.off
+	this.size -= next.n
+	return this.saveCursor()
+}
+
+func (this *Spool) saveCursor() error {
+	tmp := this.cursorPath() + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(f, "%d %d", this.readSeg, this.readOff)
+	if this.Sync != SyncNever {
+		f.Sync()
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, this.cursorPath())
+}
+
+// 损坏的记录。长度或校验和错误时长度不可信，frame为空
+type spoolCorrupt struct {
+	frame []byte
+	err   error
+}
+
+func (this *spoolCorrupt) Error() string {
+	return this.err.Error()
+}
+
+// 读取一条记录，返回记录和读取的字节数。没有更多记录时返回 io.EOF，
+// 记录不完整时返回 io.ErrUnexpectedEOF，长度或校验和错误时返回长度为0的 spoolCorrupt
+func readSpoolRecord(r *bufio.Reader) (*spoolRecord, int64, error) {
+	header := make([]byte, spoolHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, 0, err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length > maxSpoolRecordSize {
+		return nil, 0, &spoolCorrupt{err: fmt.Errorf("spool记录长度%d超出上限", length)}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	n := int64(spoolHeaderSize + len(payload))
+	if spoolChecksum(header[:4], payload) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, 0, &spoolCorrupt{err: errors.New("spool记录校验失败")}
+	}
+	record := &spoolRecord{}
+	if err := xml.Unmarshal(payload, record); err != nil {
+		return nil, n, &spoolCorrupt{frame: append(header, payload...), err: err}
+	}
+	return record, n, nil
+}
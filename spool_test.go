@@ -0,0 +1,231 @@
+package aliyunMQS
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSpool(t *testing.T) {
+	Convey("生产端spool测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		queue.CreateQueue("events", nil)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+
+		dir := t.TempDir()
+		spool, err := OpenSpool(dir, &msg)
+		So(err, ShouldBeNil)
+		defer spool.Close()
+		spool.SegmentSize = 256
+
+		receiveAll := func() []string {
+			bodies := []string{}
+			for {
+				m, err := msg.Receive("events", 0)
+				if err != nil {
+					return bodies
+				}
+				bodies = append(bodies, m.MessageBody)
+				msg.DeleteMessage("events", m.ReceiptHandle)
+			}
+		}
+
+		Convey("服务正常时直接发送", func() {
+			content, err := spool.SendMessage("events", "e1", nil)
+			So(err, ShouldBeNil)
+			So(content, ShouldContainSubstring, "MessageId")
+			So(spool.Size(), ShouldEqual, 0)
+		})
+
+		Convey("不可重试的错误直接返回", func() {
+			_, err := spool.SendMessage("missing", "e1", nil)
+			So(err, ShouldNotBeNil)
+			So(spool.Size(), ShouldEqual, 0)
+		})
+
+		Convey("参数错误不写入spool", func() {
+			mock.setDown(true)
+			_, err := spool.SendMessage("events", "e1", map[string]int{"Priority": 99})
+			So(errors.Is(err, ErrInvalidParam), ShouldBeTrue)
+			So(spool.Size(), ShouldEqual, 0)
+			So(IsRetryable(err), ShouldBeFalse)
+			So(IsRetryable(&net.OpError{Op: "dial", Err: errors.New("refused")}), ShouldBeTrue)
+			So(IsRetryable(errors.New("生成信封失败")), ShouldBeFalse)
+		})
+
+		Convey("服务不可用时写入spool，恢复后按顺序发送", func() {
+			mock.setDown(true)
+			for i := 0; i < 10; i++ {
+				content, err := spool.SendMessage("events", fmt.Sprintf("e%d", i), map[string]int{"Priority": 1})
+				So(err, ShouldBeNil)
+				So(content, ShouldEqual, "")
+			}
+			matches, _ := filepath.Glob(filepath.Join(dir, "*.seg"))
+			So(len(matches), ShouldBeGreaterThan, 1)
+
+			n, err := spool.Drain()
+			So(err, ShouldNotBeNil)
+			So(n, ShouldEqual, 0)
+
+			mock.setDown(false)
+			// spool中还有消息时新消息也写入spool
+			spool.SendMessage("events", "e10", nil)
+			n, err = spool.Drain()
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 11)
+			So(spool.Size(), ShouldEqual, 0)
+			So(receiveAll(), ShouldResemble, []string{"e0", "e1", "e2", "e3", "e4", "e5", "e6", "e7", "e8", "e9", "e10"})
+			matches, _ = filepath.Glob(filepath.Join(dir, "*.seg"))
+			So(len(matches), ShouldEqual, 1)
+		})
+
+		Convey("重新打开后继续发送未发送的消息", func() {
+			mock.setDown(true)
+			for i := 0; i < 5; i++ {
+				spool.SendMessage("events", fmt.Sprintf("e%d", i), nil)
+			}
+			mock.setDown(false)
+			record, next, err := spool.peek()
+			So(err, ShouldBeNil)
+			So(record.MessageBody, ShouldEqual, "e0")
+			So(spool.advance(next), ShouldBeNil)
+			So(spool.Close(), ShouldBeNil)
+
+			reopened, err := OpenSpool(dir, &msg)
+			So(err, ShouldBeNil)
+			defer reopened.Close()
+			So(reopened.Size(), ShouldBeGreaterThan, 0)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() { done <- reopened.Run(ctx) }()
+			for reopened.Size() > 0 {
+				time.Sleep(10 * time.Millisecond)
+			}
+			cancel()
+			<-done
+			So(receiveAll(), ShouldResemble, []string{"e1", "e2", "e3", "e4"})
+		})
+
+		Convey("不可重试的错误时停止，Reject 后继续", func() {
+			mock.setDown(true)
+			spool.SendMessage("missing", "lost", nil)
+			spool.SendMessage("events", "e1", nil)
+			mock.setDown(false)
+			n, err := spool.Drain()
+			So(errors.Is(err, ErrSpoolRejected), ShouldBeTrue)
+			So(IsQueueNotExist(err), ShouldBeTrue)
+			So(n, ShouldEqual, 0)
+			// 记录仍在队首
+			n, err = spool.Drain()
+			So(errors.Is(err, ErrSpoolRejected), ShouldBeTrue)
+
+			So(spool.Reject(), ShouldBeNil)
+			n, err = spool.Drain()
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(receiveAll(), ShouldResemble, []string{"e1"})
+			content, err := os.ReadFile(filepath.Join(dir, "rejected"))
+			So(err, ShouldBeNil)
+			So(string(content), ShouldContainSubstring, "lost")
+		})
+
+		Convey("隔离损坏的记录", func() {
+			mock.setDown(true)
+			spool.SendMessage("events", "e0", nil)
+			spool.SendMessage("events", "e1", nil)
+			mock.setDown(false)
+			So(spool.Close(), ShouldBeNil)
+			path := spool.segmentPath(0)
+			content, err := os.ReadFile(path)
+			So(err, ShouldBeNil)
+			content[spoolHeaderSize+2] ^= 0xff
+			So(os.WriteFile(path, content, 0600), ShouldBeNil)
+
+			reopened, err := OpenSpool(dir, &msg)
+			So(err, ShouldBeNil)
+			defer reopened.Close()
+			n, err := reopened.Drain()
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(reopened.Size(), ShouldEqual, 0)
+			So(receiveAll(), ShouldResemble, []string{"e1"})
+			_, err = os.Stat(filepath.Join(dir, "quarantine"))
+			So(err, ShouldBeNil)
+		})
+
+		Convey("长度损坏时隔离到下一条记录", func() {
+			mock.setDown(true)
+			for i := 0; i < 3; i++ {
+				spool.SendMessage("events", fmt.Sprintf("e%d", i), nil)
+			}
+			mock.setDown(false)
+			So(spool.Close(), ShouldBeNil)
+			path := spool.segmentPath(0)
+			content, err := os.ReadFile(path)
+			So(err, ShouldBeNil)
+
+			for _, length := range []uint32{0xffffffff, 60000, 3} {
+				corrupted := append([]byte(nil), content...)
+				binary.BigEndian.PutUint32(corrupted, length)
+				So(os.WriteFile(path, corrupted, 0600), ShouldBeNil)
+				os.Remove(filepath.Join(dir, "cursor"))
+
+				reopened, err := OpenSpool(dir, &msg)
+				So(err, ShouldBeNil)
+				// 后面的记录没有被截掉
+				So(reopened.Size(), ShouldEqual, len(content))
+				n, err := reopened.Drain()
+				So(err, ShouldBeNil)
+				So(n, ShouldEqual, 2)
+				So(reopened.Size(), ShouldEqual, 0)
+				So(reopened.Close(), ShouldBeNil)
+				So(receiveAll(), ShouldResemble, []string{"e1", "e2"})
+			}
+		})
+
+		Convey("截掉最后一条写了一半的记录", func() {
+			mock.setDown(true)
+			spool.SendMessage("events", "e0", nil)
+			spool.SendMessage("events", "e1", nil)
+			mock.setDown(false)
+			So(spool.Close(), ShouldBeNil)
+			path := spool.segmentPath(0)
+			content, err := os.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(os.WriteFile(path, content[:len(content)-3], 0600), ShouldBeNil)
+
+			reopened, err := OpenSpool(dir, &msg)
+			So(err, ShouldBeNil)
+			defer reopened.Close()
+			n, err := reopened.Drain()
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+			So(receiveAll(), ShouldResemble, []string{"e0"})
+			_, err = os.Stat(filepath.Join(dir, "quarantine"))
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("超过大小限制时返回错误", func() {
+			spool.MaxSize = 200
+			mock.setDown(true)
+			var err error
+			for i := 0; i < 5 && err == nil; i++ {
+				_, err = spool.SendMessage("events", "e", nil)
+			}
+			So(err, ShouldEqual, ErrSpoolFull)
+		})
+	})
+}
@@ -0,0 +1,110 @@
+package aliyunMQS
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+)
+
+// 订阅参数
+type SubscribeOptions struct {
+	// 预取的消息数，即channel的缓冲大小。预取的消息在本地等待期间 VisibilityTimeout 照常计时
+	Prefetch int
+	// ReceiveMessage 的长轮询等待时间,单位为秒
+	WaitSeconds int
+	// 请求出错后等待多久再次请求
+	ErrorBackoff time.Duration
+	// 已取消消息的墓碑，为nil时不检查
+	Tombstones TombstoneStore
+}
+
+// @Title 订阅队列，返回的channel在ctx被取消后关闭。消息处理完后需调用 Ack 删除。
+// 与 Consumer 相同，未到投递时间的消息重新延迟，已取消的消息(需指定 Tombstones)删除，都不会交出
+// @Param queuename 队列名称
+func (this *Message) Subscribe(ctx context.Context, queuename string) <-chan *ReceivedMessage {
+	return this.SubscribeWith(ctx, queuename, SubscribeOptions{Prefetch: 10, WaitSeconds: 30, ErrorBackoff: time.Second})
+}
+
+// @Title 同 Subscribe，可以指定预取数量等参数
+// @Param queuename 队列名称
+// @Param opts 		参数
+func (this *Message) SubscribeWith(ctx context.Context, queuename string, opts SubscribeOptions) <-chan *ReceivedMessage {
+	messages := make(chan *ReceivedMessage, opts.Prefetch)
+	go func() {
+		defer close(messages)
+		for ctx.Err() == nil {
+			msg, err := this.Receive(queuename, opts.WaitSeconds)
+			if err != nil {
+				if IsMessageNotExist(err) {
+					if wait := emptyPollWait(opts.WaitSeconds, opts.ErrorBackoff); wait > 0 {
+						sleep(ctx, wait)
+					}
+				} else if !errors.Is(err, ErrInvalidSignature) {
+					log.Printf("队列%s接收消息失败: %v", queuename, err)
+					sleep(ctx, opts.ErrorBackoff)
+				}
+				continue
+			}
+			if handled, err := this.preprocess(queuename, msg, opts.Tombstones); handled || err != nil {
+				if err != nil {
+					log.Printf("队列%s消息%s处理失败: %v", queuename, msg.MessageId, err)
+				}
+				continue
+			}
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				// 未交出的消息尽快恢复可见
+				msg.Nack(0)
+			}
+		}
+	}()
+	return messages
+}
+
+// @Title 处理成功，从队列删除消息
+func (this *ReceivedMessage) Ack() error {
+	if this.client == nil || this.ReceiptHandle == "" {
+		return errors.New("消息不是通过 Receive 获得的")
+	}
+	_, err := this.client.DeleteMessage(this.queuename, this.ReceiptHandle)
+	return err
+}
+
+// @Title 处理失败，通过 ChangeMessageVisibility 让消息在delay后重新可见
+// @Param delay 等待时间，按秒向上取整，范围 1秒~12小时
+func (this *ReceivedMessage) Nack(delay time.Duration) error {
+	return this.changeVisibility(delay)
+}
+
+// @Title 延长处理时间，消息在d之内不会被其他消费者收到
+// @Param d 延长的时间，按秒向上取整，范围 1秒~12小时
+func (this *ReceivedMessage) Extend(d time.Duration) error {
+	return this.changeVisibility(d)
+}
+
+func (this *ReceivedMessage) changeVisibility(d time.Duration) error {
+	if this.client == nil || this.ReceiptHandle == "" {
+		return errors.New("消息不是通过 Receive 获得的")
+	}
+	seconds := int(math.Ceil(d.Seconds()))
+	if seconds < minVisibilityTimeout {
+		seconds = minVisibilityTimeout
+	}
+	if seconds > maxVisibilityTimeout {
+		seconds = maxVisibilityTimeout
+	}
+	content, err := this.client.ChangeMessageVisibility(this.queuename, this.ReceiptHandle, seconds)
+	if err != nil {
+		return err
+	}
+	result, err := ParseChangeVisibility(content)
+	if err != nil {
+		return err
+	}
+	this.ReceiptHandle = result.ReceiptHandle
+	this.NextVisibleTime = result.NextVisibleTime
+	return nil
+}
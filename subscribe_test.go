@@ -0,0 +1,95 @@
+package aliyunMQS
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSubscribe(t *testing.T) {
+	Convey("订阅测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		queue.CreateQueue("feed", nil)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+		for i := 0; i < 3; i++ {
+			msg.SendMessage("feed", fmt.Sprintf("m%d", i), nil)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		messages := msg.SubscribeWith(ctx, "feed", SubscribeOptions{Prefetch: 1, WaitSeconds: 0, ErrorBackoff: time.Millisecond})
+
+		Convey("用range消费并Ack", func() {
+			got := []string{}
+			for m := range messages {
+				got = append(got, m.MessageBody)
+				So(m.Ack(), ShouldBeNil)
+				if len(got) == 3 {
+					cancel()
+				}
+			}
+			So(got, ShouldResemble, []string{"m0", "m1", "m2"})
+			So(mock.count("feed"), ShouldEqual, 0)
+		})
+
+		Convey("Extend和Nack修改可见时间", func() {
+			m := <-messages
+			handle := m.ReceiptHandle
+			So(m.Extend(time.Minute), ShouldBeNil)
+			So(m.ReceiptHandle, ShouldNotEqual, handle)
+			So(m.Nack(0), ShouldBeNil)
+			So(m.NextVisibleTime-time.Now().UnixNano()/1e6, ShouldBeLessThanOrEqualTo, 1000)
+			cancel()
+			for range messages {
+			}
+			So(mock.count("feed"), ShouldEqual, 3)
+		})
+	})
+}
+
+func TestSubscribeScheduled(t *testing.T) {
+	Convey("订阅定时和已取消的消息测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		queue.CreateQueue("feed", nil)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+		tombstones := NewMemoryTombstoneStore()
+
+		_, err := msg.ScheduleAt("feed", "later", time.Now().Add(24*time.Hour), nil)
+		So(err, ShouldBeNil)
+		content, err := msg.SendMessage("feed", "cancelled", nil)
+		So(err, ShouldBeNil)
+		result, err := ParseSendResult(content)
+		So(err, ShouldBeNil)
+		So(msg.CancelMessage(tombstones, result.MessageId, time.Hour), ShouldBeNil)
+		msg.SendMessage("feed", "now", nil)
+		// 定时消息提前可见
+		mock.expire("feed")
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		messages := msg.SubscribeWith(ctx, "feed", SubscribeOptions{WaitSeconds: 0, ErrorBackoff: time.Millisecond, Tombstones: tombstones})
+		m := <-messages
+		So(m.MessageBody, ShouldEqual, "now")
+		So(m.Ack(), ShouldBeNil)
+		select {
+		case m := <-messages:
+			So(m, ShouldBeNil)
+		case <-time.After(50 * time.Millisecond):
+		}
+		cancel()
+		for range messages {
+		}
+		// 定时消息重新延迟，已取消的消息被删除
+		So(mock.count("feed"), ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,101 @@
+package aliyunMQS
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 已取消消息的墓碑存储，消费者处理前检查，命中的消息直接删除
+type TombstoneStore interface {
+	// 添加墓碑，ttl 后过期，应不短于消息的延迟时间
+	Add(messageid string, ttl time.Duration) error
+	// 消息是否已取消
+	Contains(messageid string) (bool, error)
+	// 删除墓碑
+	Remove(messageid string) error
+}
+
+// @Title 取消一条延迟消息
+// @Param tombstones 	墓碑存储
+// @Param messageid 	发送时返回的 MessageId
+// @Param ttl 			墓碑保留时间，应不短于消息的延迟时间
+func (this *Message) CancelMessage(tombstones TombstoneStore, messageid string, ttl time.Duration) error {
+	return tombstones.Add(messageid, ttl)
+}
+
+// 内存墓碑存储，只适用于单进程
+type MemoryTombstoneStore struct {
+	lock   sync.Mutex
+	expire map[string]time.Time
+}
+
+// @Title 创建内存墓碑存储
+func NewMemoryTombstoneStore() *MemoryTombstoneStore {
+	return &MemoryTombstoneStore{expire: map[string]time.Time{}}
+}
+
+func (this *MemoryTombstoneStore) Add(messageid string, ttl time.Duration) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	now := time.Now()
+	for k, v := range this.expire {
+		if !v.After(now) {
+			delete(this.expire, k)
+		}
+	}
+	this.expire[messageid] = now.Add(ttl)
+	return nil
+}
+
+func (this *MemoryTombstoneStore) Contains(messageid string) (bool, error) {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	expire, ok := this.expire[messageid]
+	return ok && expire.After(time.Now()), nil
+}
+
+func (this *MemoryTombstoneStore) Remove(messageid string) error {
+	this.lock.Lock()
+	defer this.lock.Unlock()
+	delete(this.expire, messageid)
+	return nil
+}
+
+// SQLite墓碑存储，多个消费者进程可共享同一个数据库文件
+type SQLiteTombstoneStore struct {
+	db    *sql.DB
+	table string
+}
+
+// @Title 创建SQLite墓碑存储，表不存在时自动创建
+// @Param db 	已打开的SQLite数据库
+// @Param table 表名
+func NewSQLiteTombstoneStore(db *sql.DB, table string) (*SQLiteTombstoneStore, error) {
+	_, err := db.Exec(fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (message_id TEXT PRIMARY KEY, expire_at INTEGER NOT NULL)", table))
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteTombstoneStore{db: db, table: table}, nil
+}
+
+func (this *SQLiteTombstoneStore) Add(messageid string, ttl time.Duration) error {
+	now := time.Now()
+	if _, err := this.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE expire_at <= ?", this.table), now.UnixNano()); err != nil {
+		return err
+	}
+	_, err := this.db.Exec(fmt.Sprintf("INSERT OR REPLACE INTO %s (message_id, expire_at) VALUES (?, ?)", this.table), messageid, now.Add(ttl).UnixNano())
+	return err
+}
+
+func (this *SQLiteTombstoneStore) Contains(messageid string) (bool, error) {
+	var n int
+	err := this.db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE message_id = ? AND expire_at > ?", this.table), messageid, time.Now().UnixNano()).Scan(&n)
+	return n > 0, err
+}
+
+func (this *SQLiteTombstoneStore) Remove(messageid string) error {
+	_, err := this.db.Exec(fmt.Sprintf("DELETE FROM %s WHERE message_id = ?", this.table), messageid)
+	return err
+}
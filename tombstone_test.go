@@ -0,0 +1,92 @@
+package aliyunMQS
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTombstoneStore(t *testing.T) {
+	Convey("墓碑存储测试", t, func() {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "tombstones.db"))
+		So(err, ShouldBeNil)
+		defer db.Close()
+		sqlite, err := NewSQLiteTombstoneStore(db, "tombstones")
+		So(err, ShouldBeNil)
+
+		for name, store := range map[string]TombstoneStore{"内存": NewMemoryTombstoneStore(), "SQLite": sqlite} {
+			Convey(name, func() {
+				So(store.Add("m1", time.Hour), ShouldBeNil)
+				So(store.Add("m2", -time.Second), ShouldBeNil)
+				ok, err := store.Contains("m1")
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+				ok, _ = store.Contains("m2")
+				So(ok, ShouldBeFalse)
+				So(store.Remove("m1"), ShouldBeNil)
+				ok, _ = store.Contains("m1")
+				So(ok, ShouldBeFalse)
+			})
+		}
+	})
+}
+
+func TestCancelMessage(t *testing.T) {
+	Convey("取消延迟消息测试", t, func() {
+		mock := newMockMQS()
+		defer mock.Close()
+		var queue Queue
+		mock.NewMQS(&queue.MQS)
+		queue.CreateQueue("timeouts", nil)
+		var msg Message
+		mock.NewMQS(&msg.MQS)
+
+		delivered := []string{}
+		consumer := NewConsumer(&msg, "timeouts", func(m *ReceivedMessage) error {
+			delivered = append(delivered, m.MessageBody)
+			return nil
+		})
+		consumer.Tombstones = NewMemoryTombstoneStore()
+
+		Convey("取消的消息被静默删除", func() {
+			content, err := msg.SendMessage("timeouts", "order-1", map[string]int{"DelaySeconds": 60})
+			So(err, ShouldBeNil)
+			msg.SendMessage("timeouts", "order-2", map[string]int{"DelaySeconds": 60})
+			result, err := ParseSendResult(content)
+			So(err, ShouldBeNil)
+			So(msg.CancelMessage(consumer.Tombstones, result.MessageId, time.Hour), ShouldBeNil)
+
+			mock.expire("timeouts")
+			for i := 0; i < 2; i++ {
+				m, err := msg.Receive("timeouts", 0)
+				So(err, ShouldBeNil)
+				So(consumer.Process(m), ShouldBeNil)
+			}
+			So(delivered, ShouldResemble, []string{"order-2"})
+			So(mock.count("timeouts"), ShouldEqual, 0)
+		})
+
+		Convey("重新延迟后仍按最初的MessageId取消", func() {
+			content, err := msg.ScheduleAt("timeouts", "later", time.Now().Add(7*24*time.Hour), nil)
+			So(err, ShouldBeNil)
+			result, _ := ParseSendResult(content)
+
+			mock.expire("timeouts")
+			m, _ := msg.Receive("timeouts", 0)
+			So(consumer.Process(m), ShouldBeNil)
+			So(msg.CancelMessage(consumer.Tombstones, result.MessageId, time.Hour), ShouldBeNil)
+
+			mock.expire("timeouts")
+			m, _ = msg.Receive("timeouts", 0)
+			So(m.MessageId, ShouldNotEqual, result.MessageId)
+			So(m.OriginMessageId(), ShouldEqual, result.MessageId)
+			So(consumer.Process(m), ShouldBeNil)
+			So(delivered, ShouldBeEmpty)
+			So(mock.count("timeouts"), ShouldEqual, 0)
+		})
+	})
+}